@@ -6,22 +6,218 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
-	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
-
-	mecab "github.com/shogo82148/go-mecab"
 )
 
-const ipadic = "/usr/local/lib/mecab/dic/mecab-ipadic-neologd"
-
 var newsArticleNames = []string{"rss.jsonl"}
 
-func transformAnalysis(src, dest string, date time.Time) error {
-	dateStr := date.Format("20060102")
+// analysisOptions はキーワード抽出の設定を表す
+type analysisOptions struct {
+	// tokenizer は形態素解析器の名前
+	tokenizer string
+	// posFilter は抽出対象とする品詞
+	posFilter posFilter
+	// titleRules はタイトルの正規化ルールのファイル。空の場合は既定のルールを用いる
+	titleRules string
+	// dictionary はストップワードと表記揺れの辞書のファイル。空の場合は用いない
+	dictionary string
+	// topicFile は出力するランキングのファイル名
+	topicFile string
+	// period は集計期間 (daily, weekly, monthly, quarterly, yearly)
+	period string
+	// trend は急上昇キーワード検出の設定
+	trend trendOptions
+	// weight はランキングの順位付けに用いる値
+	// (articles: 記事数, feeds: 記事を掲載していたRSSの延べ数, tfidf: 過去の記事と比べた TF-IDF)
+	weight string
+	// historyDays は TF-IDF の文書頻度を集計する集計期間より前の日数
+	historyDays int
+	// top はランキングに出力するキーワードの最大数
+	top int
+	// minCount はランキングに出力するキーワードの最小の記事数
+	minCount int
+	// compoundMax は複合名詞とする連続した名詞の最大数。1以下の場合は複合名詞を抽出しない
+	compoundMax int
+	// ngram は抽出する形態素の n-gram の n。1以下の場合は n-gram を抽出しない
+	ngram int
+	// graphFile は出力する共起グラフのファイル名 (拡張子を除く)。空の場合は出力しない
+	graphFile string
+	// story はほぼ同じ見出しの記事をストーリーにまとめる設定
+	story storyOptions
+	// description はタイトルに加えて記事の概要からもキーワードを抽出する場合に true
+	description bool
+	// text はキーワードを抽出する対象 (title: タイトル, body: 本文, both: タイトルと本文)
+	text string
+}
+
+// rankWeights は `--weight` フラグに指定できるランキングの順位付けに用いる値
+var rankWeights = []string{"articles", "feeds", "tfidf"}
+
+// defaultAnalysisOptions は人名を抽出して topic.json に出力する設定を返す
+func defaultAnalysisOptions() analysisOptions {
+	return analysisOptions{
+		tokenizer:   "mecab",
+		posFilter:   posFilter{parsePOSPattern(posPresets[defaultPOSPreset][0])},
+		topicFile:   "topic.json",
+		period:      "daily",
+		trend:       defaultTrendOptions(),
+		weight:      "articles",
+		historyDays: 30,
+		top:         30,
+		minCount:    1,
+		story:       defaultStoryOptions(),
+		text:        "title",
+	}
+}
+
+// transformAnalysis は date から始まる集計期間のニュース記事からキーワードを抽出してランキングを出力する
+func transformAnalysis(src, dest string, date time.Time, opts analysisOptions) error {
+	ex, err := newKeywordExtractor(opts)
+	if err != nil {
+		return err
+	}
+	defer ex.close()
+	return analyzePeriod(src, dest, date, opts, ex, newDayCounter(src, ex))
+}
+
+// analyzePeriod は ex で date から始まる集計期間のランキングを出力する
+// 急上昇キーワードと TF-IDF で参照する過去の日の集計結果は counter に保持して、複数の日付の間でも共有する
+func analyzePeriod(src, dest string, date time.Time, opts analysisOptions, ex *keywordExtractor, counter *dayCounter) error {
+	days, err := periodDays(opts.period, date)
+	if err != nil {
+		return err
+	}
+	articles, found, missing := readPeriodArticles(src, days, opts.text != "title")
+
+	// ストーリーへのまとめは記事数が多いと時間がかかるので、集計期間の記事について1度だけ行い、カテゴリ別の集計でも用いる
+	var stories []Story
+	if opts.story.enabled || opts.story.countBy == "story" {
+		stories = clusterStories(articles, ex, opts.story)
+	}
+	var storyOf map[string]int
+	if opts.story.countBy == "story" {
+		storyOf = storyIndex(stories)
+	}
+	counts, err := countStoryKeywords(articles, ex, storyOf)
+	if err != nil {
+		return err
+	}
+	var df *documentFrequency
+	if opts.weight == "tfidf" {
+		df, err = newDocumentFrequency(counter, date, opts.historyDays)
+		if err != nil {
+			return err
+		}
+		df.score(counts)
+	}
+	contentItems := toContents(counts, opts)
+
+	categories, err := toCategoryContents(articles, ex, df, storyOf, opts)
+	if err != nil {
+		return err
+	}
+
+	content := Content{
+		FormatDate: formatPeriod(days),
+		Date:       date.Format(time.RFC3339),
+		Items:      contentItems,
+		Categories: categories,
+	}
+	if df != nil {
+		content.HistoryDays = df.days
+	}
+	if opts.story.countBy == "story" {
+		content.CountBy = opts.story.countBy
+	}
+	if opts.trend.enabled {
+		content.TrendingFile = opts.trend.trendingFile
+	}
+	if opts.story.enabled {
+		content.StoriesFile = opts.story.storiesFile
+	}
+	if opts.period != "daily" {
+		content.Period = opts.period
+		content.Days = found
+		content.MissingDays = missing
+	}
+
+	dir := periodDir(opts.period, date)
+	if err := writeContentMecab(dest, dir, opts.topicFile, content); err != nil {
+		return err
+	}
+
+	if opts.graphFile != "" {
+		graph, err := toCooccurrenceGraph(articles, ex, contentItems)
+		if err != nil {
+			return err
+		}
+		graph.FormatDate = content.FormatDate
+		graph.Date = content.Date
+		if err := writeCooccurrenceGraph(dest, dir, opts.graphFile, graph); err != nil {
+			return err
+		}
+	}
+
+	if opts.story.enabled {
+		stories := Content{
+			FormatDate:  content.FormatDate,
+			Date:        content.Date,
+			Period:      content.Period,
+			Days:        content.Days,
+			MissingDays: content.MissingDays,
+			Stories:     multiArticleStories(stories),
+			TopicFile:   opts.topicFile,
+		}
+		if err := writeContentMecab(dest, dir, opts.story.storiesFile, stories); err != nil {
+			return err
+		}
+	}
+
+	if !opts.trend.enabled {
+		return nil
+	}
+	baseline, baselineDays, err := countBaseline(counter, date, opts.trend.baselineDays)
+	if err != nil {
+		return err
+	}
+	trending := Content{
+		FormatDate:   content.FormatDate,
+		Date:         content.Date,
+		Items:        toTrending(counts, len(found), baseline, opts),
+		Period:       content.Period,
+		Days:         content.Days,
+		MissingDays:  content.MissingDays,
+		BaselineDays: baselineDays,
+		CountBy:      content.CountBy,
+		TopicFile:    opts.topicFile,
+	}
+	return writeContentMecab(dest, dir, opts.trend.trendingFile, trending)
+}
+
+// readPeriodArticles は集計期間の各日のニュース記事を読み込む
+// 記事ファイルを読み込めた日と読み込めなかった日をそれぞれ YYYYMMDD 形式で返す
+func readPeriodArticles(src string, days []time.Time, withBody bool) (articles []NewsArticleJSON, found, missing []string) {
+	for _, day := range days {
+		dateStr := day.Format("20060102")
+		a, ok := readDayArticles(src, dateStr, withBody)
+		if ok {
+			articles = append(articles, a...)
+			found = append(found, dateStr)
+		} else {
+			missing = append(missing, dateStr)
+		}
+	}
+	return articles, found, missing
+}
+
+// readDayArticles は dateStr の日のニュース記事を読み込む。記事ファイルを読み込めなかった場合は false を返す
+// withBody が true の場合は articles コマンドで保存した本文も読み込む
+func readDayArticles(src, dateStr string, withBody bool) ([]NewsArticleJSON, bool) {
 	var articles []NewsArticleJSON
+	ok := false
 	for _, fileName := range newsArticleNames {
 		path := filepath.Join(src, dateStr, fileName)
 		a, err := readArticles(path)
@@ -30,27 +226,27 @@ func transformAnalysis(src, dest string, date time.Time) error {
 			continue
 		}
 		articles = append(articles, a...)
+		ok = true
 	}
-
-	contentItems := toContents(articles)
-	if len(contentItems) >= 30 {
-		contentItems = contentItems[:30]
+	if !ok || !withBody {
+		return articles, ok
 	}
 
-	content := Content{
-		FormatDate: date.Format("2006/01/02"),
-		Date:       date.Format(time.RFC3339),
-		Items:      contentItems,
+	path := filepath.Join(src, dateStr, articleBodyFile)
+	bodies, err := readArticleBodies(path)
+	if err != nil {
+		// 本文の読み込みに失敗してもタイトルは集計できるので warnnig log を出力する
+		fmt.Println("failed to read article bodies.", zap.String("path", path), zap.Error(err))
+		return articles, ok
 	}
-
-	if err := writeContentMecab(dest, dateStr, "topic.json", content); err != nil {
-		return err
+	for i, a := range articles {
+		articles[i].Body = bodies[a.URL].Body
 	}
-	return nil
+	return articles, ok
 }
 
-func writeContentMecab(dest, dateStr, fileName string, c Content) error {
-	f, err := createOutFile(filepath.Join(dest, dateStr, fileName))
+func writeContentMecab(dest, dir, fileName string, c Content) error {
+	f, err := createOutFile(filepath.Join(dest, dir, fileName))
 	if err != nil {
 		return err
 	}
@@ -87,75 +283,307 @@ func readArticles(path string) ([]NewsArticleJSON, error) {
 	return articles, nil
 }
 
-func toContents(articles []NewsArticleJSON) []ContentItem {
-	mecab, err := mecab.New(map[string]string{"dicdir": ipadic})
+// toCategoryContents は記事をカテゴリごとに分けて、カテゴリ別のランキングを作成する
+// 複数のRSSに掲載されていた記事はそれぞれのカテゴリで集計し、カテゴリのない記事は集計しない
+// df が nil でない場合は TF-IDF を算出する。storyOf が nil でない場合はストーリーごとに数える
+func toCategoryContents(articles []NewsArticleJSON, ex *keywordExtractor, df *documentFrequency, storyOf map[string]int, opts analysisOptions) ([]CategoryContent, error) {
+	byCategory := make(map[string][]NewsArticleJSON)
+	names := make(map[string]string)
+	for _, article := range articles {
+		for _, feed := range article.articleFeeds() {
+			byCategory[feed.ID] = append(byCategory[feed.ID], article)
+			names[feed.ID] = feed.Name
+		}
+	}
+
+	var ret []CategoryContent
+	for id, a := range byCategory {
+		counts, err := countStoryKeywords(a, ex, storyOf)
+		if err != nil {
+			return nil, err
+		}
+		if df != nil {
+			df.score(counts)
+		}
+		items := toContents(counts, opts)
+		if len(items) == 0 {
+			continue
+		}
+		ret = append(ret, CategoryContent{
+			ID:    id,
+			Name:  names[id],
+			Items: items,
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ID < ret[j].ID })
+	return ret, nil
+}
+
+// keywordExtractor はニュース記事のタイトルからキーワードを抽出する
+type keywordExtractor struct {
+	tokenizer  Tokenizer
+	filter     posFilter
+	normalizer *titleNormalizer
+	dictionary *keywordDictionary
+	// compoundMax は複合名詞とする連続した名詞の最大数。1以下の場合は複合名詞を抽出しない
+	compoundMax int
+	// ngram は抽出する形態素の n-gram の n。1以下の場合は n-gram を抽出しない
+	ngram int
+	// story はキーワードをストーリーごとに数える場合の設定
+	story storyOptions
+	// description はタイトルに加えて記事の概要からもキーワードを抽出する場合に true
+	description bool
+	// text はキーワードを抽出する対象 (title: タイトル, body: 本文, both: タイトルと本文)
+	text string
+}
+
+// newKeywordExtractor は設定に従って形態素解析器などを初期化する。利用後は close を呼ぶ
+func newKeywordExtractor(opts analysisOptions) (*keywordExtractor, error) {
+	normalizer, err := newTitleNormalizer(opts.titleRules)
+	if err != nil {
+		return nil, err
+	}
+	dictionary, err := newKeywordDictionary(opts.dictionary)
+	if err != nil {
+		return nil, err
+	}
+	tokenizer, err := newTokenizer(opts.tokenizer)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	return &keywordExtractor{
+		tokenizer:   tokenizer,
+		filter:      opts.posFilter,
+		normalizer:  normalizer,
+		dictionary:  dictionary,
+		compoundMax: opts.compoundMax,
+		ngram:       opts.ngram,
+		story:       opts.story,
+		description: opts.description,
+		text:        opts.text,
+	}, nil
+}
+
+func (ex *keywordExtractor) close() error {
+	return ex.tokenizer.Close()
+}
+
+// countKeywords はニュース記事のタイトルから品詞フィルタにマッチするキーワードを抽出して、キーワードごとの記事を集計する
+// ストーリーごとに数える場合は、記事をストーリーにまとめて同じストーリーの記事を1件として数える
+func countKeywords(articles []NewsArticleJSON, ex *keywordExtractor) (map[string]ContentItem, error) {
+	var storyOf map[string]int
+	if ex.story.countBy == "story" {
+		storyOf = storyIndex(clusterStories(articles, ex, ex.story))
 	}
-	defer mecab.Destroy()
+	return countStoryKeywords(articles, ex, storyOf)
+}
 
+// countStoryKeywords はキーワードごとの記事を集計する。storyOf が nil でない場合は記事のURLから引いたストーリーごとに数える
+func countStoryKeywords(articles []NewsArticleJSON, ex *keywordExtractor, storyOf map[string]int) (map[string]ContentItem, error) {
 	m := make(map[string]ContentItem)
+	storiesOf := make(map[string]map[int]bool)
 	for _, article := range articles {
-		title := strings.TrimSpace(strings.ToLower(article.Title))
-		i := strings.LastIndex(title, "(")
-		if i >= 0 {
-			title = title[:i]
-		}
-		i = strings.LastIndex(title, "（")
-		if i >= 0 {
-			title = title[:i]
-		}
-		i = strings.LastIndex(title, "[")
-		if i >= 0 {
-			title = title[:i]
-		}
-		i = strings.LastIndex(title, "〈")
-		if i >= 0 {
-			title = title[:i]
-		}
-		i = strings.LastIndex(title, "【")
-		if i >= 0 {
-			title = title[:i]
-		}
-		i = strings.Index(title, "]")
-		if i >= 0 {
-			title = title[i:]
-		}
-		title = strings.ReplaceAll(title, ":", "")
-		title = strings.ReplaceAll(title, "にも", "")
-		node, err := mecab.ParseToNode(title)
+		keywords, err := ex.extractArticle(article)
 		if err != nil {
-			panic(err)
-		}
-
-		for ; !node.IsZero(); node = node.Next() {
-			features := strings.Split(node.Feature(), ",")
-			if features[0] == "名詞" && features[1] == "固有名詞" && features[2] == "人名" && features[3] == "一般" {
-				// fmt.Println(node.String())
-				word := node.Surface()
-				contentItem, ok := m[word]
-				if !ok {
-					contentItem = ContentItem{
-						Word:  word,
-						Count: 0,
-					}
-					m[word] = contentItem
+			return nil, err
+		}
+
+		// 同じ記事に同じキーワードが複数回現れても1記事として数える
+		seen := make(map[string]bool)
+		for _, k := range keywords {
+			contentItem, ok := m[k.word]
+			if !ok {
+				contentItem = ContentItem{
+					Word:  k.word,
+					Count: 0,
+					Kind:  k.kind,
 				}
-				a := Article{
-					Title: article.Title,
-					URL:   article.URL,
+			}
+			if k.surface != k.word && !contains(contentItem.Variants, k.surface) {
+				contentItem.Variants = append(contentItem.Variants, k.surface)
+			}
+			if seen[k.word] {
+				m[k.word] = contentItem
+				continue
+			}
+			seen[k.word] = true
+
+			contentItem.Articles = append(contentItem.Articles, article.article())
+			contentItem.Count = len(contentItem.Articles)
+			if storyOf != nil {
+				if storiesOf[k.word] == nil {
+					storiesOf[k.word] = make(map[int]bool)
 				}
-				contentItem.Articles = append(contentItem.Articles, a)
-				contentItem.Count = len(contentItem.Articles)
-				m[word] = contentItem
+				storiesOf[k.word][storyOf[article.URL]] = true
+				contentItem.Count = len(storiesOf[k.word])
+			}
+			if feeds := len(article.articleFeeds()); feeds > 0 {
+				contentItem.FeedCount += feeds
+			} else {
+				contentItem.FeedCount++
+			}
+			m[k.word] = contentItem
+		}
+	}
+	return m, nil
+}
+
+// keyword はタイトルから抽出したキーワードを表す
+type keyword struct {
+	// word は表記揺れをまとめた後のキーワード
+	word string
+	// surface はタイトルに現れた表記
+	surface string
+	// kind は複合名詞の場合は compound、n-gram の場合は ngram、1つの形態素の場合は空
+	kind string
+}
+
+// extractArticle は text に従って記事のタイトルと本文からキーワードを抽出する
+// 本文だけを対象とする場合でも、本文を取得できていない記事はタイトルから抽出する
+// description が true の場合は記事の概要からも抽出する
+// 正規化ルールはタイトルのためのものなので、概要と本文には適用しない
+func (ex *keywordExtractor) extractArticle(article NewsArticleJSON) ([]keyword, error) {
+	// タイトルが集計から除かれた記事は概要と本文も集計しない
+	if _, ok := ex.normalizer.normalize(article.Title); !ok {
+		return nil, nil
+	}
+
+	var ret []keyword
+	if ex.text != "body" || article.Body == "" {
+		keywords, err := ex.extract(article.Title)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, keywords...)
+	}
+	var texts []string
+	if ex.text != "title" {
+		texts = append(texts, article.Body)
+	}
+	if ex.description {
+		texts = append(texts, article.Description)
+	}
+	for _, text := range texts {
+		if text == "" {
+			continue
+		}
+		keywords, err := ex.extractText(text)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, keywords...)
+	}
+	return ret, nil
+}
+
+// extract はタイトルを正規化して形態素解析し、品詞フィルタにマッチしてストップワードでないキーワードを返す
+func (ex *keywordExtractor) extract(title string) ([]keyword, error) {
+	title, ok := ex.normalizer.normalize(title)
+	if !ok {
+		return nil, nil
+	}
+	return ex.extractText(title)
+}
+
+// extractText はテキストを形態素解析し、品詞フィルタにマッチしてストップワードでないキーワードを返す
+func (ex *keywordExtractor) extractText(text string) ([]keyword, error) {
+	tokens, err := ex.tokenizer.Tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []keyword
+	for _, token := range tokens {
+		if !ex.filter.match(token.Features) {
+			continue
+		}
+		word, ok := ex.dictionary.canonical(token.Surface)
+		if !ok {
+			continue
+		}
+		ret = append(ret, keyword{word: word, surface: token.Surface})
+	}
+
+	phrases := []struct {
+		kind    string
+		phrases []string
+	}{
+		{kind: "compound", phrases: compoundNouns(tokens, ex.compoundMax)},
+		{kind: "ngram", phrases: tokenNGrams(tokens, ex.ngram)},
+	}
+	for _, p := range phrases {
+		for _, phrase := range p.phrases {
+			word, ok := ex.dictionary.canonical(phrase)
+			if !ok {
+				continue
 			}
+			ret = append(ret, keyword{word: word, surface: phrase, kind: p.kind})
 		}
 	}
+	return ret, nil
+}
+
+// toContents は記事数が minCount 以上のキーワードを weight の多い順に並べて、上位 top 件を返す
+// キーワードが top 件に満たない場合は全てのキーワードを返す
+func toContents(m map[string]ContentItem, opts analysisOptions) []ContentItem {
 	var ret []ContentItem
 	for _, val := range m {
-		// fmt.Println(fmt.Sprintf("\"%s\":            {},", key))
+		if val.Count < opts.minCount {
+			continue
+		}
 		ret = append(ret, val)
 	}
-	sort.Slice(ret, func(i, j int) bool { return ret[i].Count > ret[j].Count })
-	return ret[:100]
+	sortContentItems(ret, func(c ContentItem) float64 { return c.rankValue(opts.weight) })
+	return limitItems(ret, opts.top)
+}
+
+// sortContentItems はキーワードを value の大きい順に並べる
+// 同じ値の場合は最も早い記事の日時が早い順、キーワード順に並べて、実行するたびに順序が変わらないようにする
+// キーワードごとの記事と表記揺れも日時順、URL順に並べる
+func sortContentItems(items []ContentItem, value func(ContentItem) float64) {
+	earliest := make(map[string]time.Time, len(items))
+	for _, item := range items {
+		sortArticles(item.Articles)
+		sort.Strings(item.Variants)
+		if len(item.Articles) > 0 {
+			earliest[item.Word] = parseArticleDate(item.Articles[0].Date)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if vi, vj := value(items[i]), value(items[j]); vi != vj {
+			return vi > vj
+		}
+		if ei, ej := earliest[items[i].Word], earliest[items[j].Word]; !ei.Equal(ej) {
+			return ei.Before(ej)
+		}
+		return items[i].Word < items[j].Word
+	})
+}
+
+// sortArticles は記事を日時順、URL順に並べる
+func sortArticles(articles []Article) {
+	sort.SliceStable(articles, func(i, j int) bool {
+		di, dj := parseArticleDate(articles[i].Date), parseArticleDate(articles[j].Date)
+		if !di.Equal(dj) {
+			return di.Before(dj)
+		}
+		return articles[i].URL < articles[j].URL
+	})
+}
+
+// parseArticleDate は記事の日時を返す。日時がない、または解析できない場合はゼロ値を返す
+func parseArticleDate(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// limitItems は先頭から最大 top 件を返す。top が0以下の場合は全件を返す
+func limitItems(items []ContentItem, top int) []ContentItem {
+	if top > 0 && len(items) > top {
+		return items[:top]
+	}
+	return items
 }
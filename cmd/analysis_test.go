@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// testArticles は地名を含むタイトルの記事を n 件返す
+// 東京と大阪は2記事、名古屋は1記事に現れる
+func testArticles(n int) []NewsArticleJSON {
+	titles := []string{
+		"東京で感染拡大",
+		"東京と大阪で会見",
+		"大阪と名古屋で雨",
+	}
+	var ret []NewsArticleJSON
+	for i := 0; i < n; i++ {
+		ret = append(ret, NewsArticleJSON{
+			Date:  fmt.Sprintf("2020-12-18T%02d:00:00+09:00", 10+i),
+			URL:   fmt.Sprintf("https://example.com/%d", i+1),
+			Title: titles[i],
+		})
+	}
+	return ret
+}
+
+func newTestExtractor(t *testing.T) *keywordExtractor {
+	t.Helper()
+	opts := defaultAnalysisOptions()
+	opts.tokenizer = "kagome"
+	opts.posFilter = posFilter{parsePOSPattern(posPresets["place"][0])}
+	ex, err := newKeywordExtractor(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ex.close() })
+	return ex
+}
+
+func TestCountKeywords(t *testing.T) {
+	ex := newTestExtractor(t)
+	tests := []struct {
+		articles int
+		want     map[string]int
+	}{
+		{articles: 0, want: map[string]int{}},
+		{articles: 1, want: map[string]int{"東京": 1}},
+		{articles: 3, want: map[string]int{"東京": 2, "大阪": 2, "名古屋": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d articles", tt.articles), func(t *testing.T) {
+			m, err := countKeywords(testArticles(tt.articles), ex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(m) != len(tt.want) {
+				t.Errorf("got %d keywords, want %d: %v", len(m), len(tt.want), m)
+			}
+			for word, count := range tt.want {
+				if m[word].Count != count {
+					t.Errorf("count of %s = %d, want %d", word, m[word].Count, count)
+				}
+			}
+		})
+	}
+}
+
+func TestToContents(t *testing.T) {
+	ex := newTestExtractor(t)
+	tests := []struct {
+		articles int
+		top      int
+		minCount int
+		want     []string
+	}{
+		{articles: 0, top: 30, minCount: 1, want: nil},
+		{articles: 0, top: 0, minCount: 1, want: nil},
+		{articles: 1, top: 30, minCount: 1, want: []string{"東京"}},
+		{articles: 1, top: 1, minCount: 1, want: []string{"東京"}},
+		{articles: 1, top: 30, minCount: 2, want: nil},
+		{articles: 3, top: 30, minCount: 1, want: []string{"東京", "大阪", "名古屋"}},
+		{articles: 3, top: 2, minCount: 1, want: []string{"東京", "大阪"}},
+		{articles: 3, top: 1, minCount: 1, want: []string{"東京"}},
+		{articles: 3, top: 0, minCount: 1, want: []string{"東京", "大阪", "名古屋"}},
+		{articles: 3, top: 30, minCount: 2, want: []string{"東京", "大阪"}},
+		{articles: 3, top: 0, minCount: 3, want: nil},
+	}
+	for _, tt := range tests {
+		name := fmt.Sprintf("%d articles top %d min-count %d", tt.articles, tt.top, tt.minCount)
+		t.Run(name, func(t *testing.T) {
+			m, err := countKeywords(testArticles(tt.articles), ex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := defaultAnalysisOptions()
+			opts.top = tt.top
+			opts.minCount = tt.minCount
+			items := toContents(m, opts)
+
+			if tt.top > 0 && len(items) > tt.top {
+				t.Errorf("got %d items, want at most %d", len(items), tt.top)
+			}
+			var words []string
+			for _, item := range items {
+				if item.Count < tt.minCount {
+					t.Errorf("%s has %d articles, want at least %d", item.Word, item.Count, tt.minCount)
+				}
+				words = append(words, item.Word)
+			}
+			if fmt.Sprint(words) != fmt.Sprint(tt.want) {
+				t.Errorf("got %v, want %v", words, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitItems(t *testing.T) {
+	items := []ContentItem{{Word: "a"}, {Word: "b"}, {Word: "c"}}
+	tests := []struct {
+		items []ContentItem
+		top   int
+		want  int
+	}{
+		{items: nil, top: 30, want: 0},
+		{items: nil, top: 0, want: 0},
+		{items: items[:1], top: 30, want: 1},
+		{items: items, top: 2, want: 2},
+		{items: items, top: 3, want: 3},
+		{items: items, top: 0, want: 3},
+	}
+	for _, tt := range tests {
+		if got := limitItems(tt.items, tt.top); len(got) != tt.want {
+			t.Errorf("limitItems(%d items, %d) returned %d items, want %d", len(tt.items), tt.top, len(got), tt.want)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/pkg/errors"
+	"github.com/saintfish/chardet"
+	"go.uber.org/zap"
+	"golang.org/x/net/html/charset"
+)
+
+// articleBodyFile は記事ページから抽出した本文を保存するファイル名
+const articleBodyFile = "body.jsonl"
+
+// defaultBodySelectors は記事の本文を探す CSS セレクタ。先頭から順に探して最初に本文が見つかったものを用いる
+var defaultBodySelectors = []string{
+	".article_body",
+	"[class*=articleBody]",
+	"[class*=highLightSearchTarget]",
+	"article",
+	"main",
+}
+
+// textSources は `--text` フラグに指定できるキーワードを抽出する対象
+var textSources = []string{"title", "body", "both"}
+
+// ArticleBody は記事ページから抽出した本文を表す
+type ArticleBody struct {
+	URL   string `json:"url"`
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	// FetchedAt は記事ページを取得した時刻
+	FetchedAt string `json:"fetched_at"`
+}
+
+// articleBodyOptions は記事ページ取得の設定を表す
+type articleBodyOptions struct {
+	fetch fetchOptions
+	// selectors は本文を探す CSS セレクタ
+	selectors []string
+	// force は取得済みの記事ページも取得し直す場合に true
+	force bool
+}
+
+// fetchArticleBodies は date の rss.jsonl に記載された記事ページを並列に取得して、本文を dest/YYYYMMDD/body.jsonl に保存する
+// 取得済みの記事ページは body.jsonl をキャッシュとして再取得しない。force の場合は全て再取得する
+// 取得に失敗した記事があっても処理は止めずに、最後に取得結果をまとめて出力する
+// 再取得に失敗した記事は body.jsonl に保存済みの本文を残す
+func fetchArticleBodies(src, dest string, date time.Time, opts articleBodyOptions) error {
+	dateStr := date.Format("20060102")
+	articles, err := readArticles(filepath.Join(src, dateStr, "rss.jsonl"))
+	if err != nil {
+		return err
+	}
+
+	outPath := filepath.Join(dest, dateStr, articleBodyFile)
+	cache, err := readArticleBodies(outPath)
+	if err != nil {
+		return err
+	}
+
+	var targets []NewsArticleJSON
+	for _, a := range articles {
+		if _, ok := cache[a.URL]; opts.force || !ok {
+			targets = append(targets, a)
+		}
+	}
+
+	f := newFetcher(opts.fetch)
+	bodies := make([]ArticleBody, len(targets))
+	errs := make([]error, len(targets))
+	parallel(len(targets), opts.fetch.concurrency, func(i int) {
+		bodies[i], errs[i] = fetchArticleBody(f, targets[i], opts.selectors)
+	})
+
+	var fetched, failed int
+	for i, err := range errs {
+		if err != nil {
+			failed++
+			fmt.Println("failed to fetch article", zap.String("url", targets[i].URL), zap.Error(err))
+			continue
+		}
+		fetched++
+		cache[bodies[i].URL] = bodies[i]
+	}
+	fmt.Printf("fetched %d articles, %d cached, %d failed\n", fetched, len(articles)-len(targets), failed)
+
+	if fetched == 0 {
+		return nil
+	}
+	return writeArticleBodies(outPath, cache)
+}
+
+func fetchArticleBody(f *fetcher, article NewsArticleJSON, selectors []string) (ArticleBody, error) {
+	req, err := http.NewRequest(http.MethodGet, article.URL, nil)
+	if err != nil {
+		return ArticleBody{}, errors.Wrapf(err, "invalid url : %s", article.URL)
+	}
+	res, err := f.do(req)
+	if err != nil {
+		return ArticleBody{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return ArticleBody{}, errors.Errorf("status code expected 200 but was %d : url=%s", res.StatusCode, article.URL)
+	}
+
+	doc, err := newHTMLDocument(res.Body)
+	if err != nil {
+		return ArticleBody{}, errors.Wrapf(err, "failed parse response body : %s", article.URL)
+	}
+	body := extractBody(doc, selectors)
+	if body == "" {
+		return ArticleBody{}, errors.Errorf("article body not found : url=%s", article.URL)
+	}
+	return ArticleBody{
+		URL:       article.URL,
+		Title:     article.Title,
+		Body:      body,
+		FetchedAt: time.Now().Format(time.RFC3339),
+	}, nil
+}
+
+// newHTMLDocument は文字コードを判定して UTF-8 に変換した HTML を解析する
+func newHTMLDocument(r io.Reader) (*goquery.Document, error) {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read response body")
+	}
+
+	// 文字コード判定
+	var reader io.Reader = bytes.NewReader(buf)
+	if detRslt, err := chardet.NewTextDetector().DetectBest(buf); err == nil {
+		// 文字コード変換
+		if r, err := charset.NewReaderLabel(detRslt.Charset, bytes.NewReader(buf)); err == nil {
+			reader = r
+		}
+	}
+	return goquery.NewDocumentFromReader(reader)
+}
+
+// extractBody は selectors の順に本文を探して、段落ごとに改行で区切ったテキストを返す
+// どのセレクタにも本文がない場合は、ページ内の全ての段落をつなげる
+func extractBody(doc *goquery.Document, selectors []string) string {
+	doc.Find("script, style, noscript, iframe, nav, header, footer, aside").Remove()
+	for _, selector := range selectors {
+		s := doc.Find(selector).First()
+		if s.Length() == 0 {
+			continue
+		}
+		if body := paragraphText(s); body != "" {
+			return body
+		}
+	}
+	var paragraphs []string
+	doc.Find("p").Each(func(_ int, s *goquery.Selection) {
+		if text := strings.Join(strings.Fields(s.Text()), " "); text != "" {
+			paragraphs = append(paragraphs, text)
+		}
+	})
+	return strings.Join(paragraphs, "\n")
+}
+
+// paragraphText は段落ごとに改行で区切ったテキストを返す。段落がない場合は全体のテキストを返す
+func paragraphText(s *goquery.Selection) string {
+	var paragraphs []string
+	s.Find("p").Each(func(_ int, p *goquery.Selection) {
+		if text := strings.Join(strings.Fields(p.Text()), " "); text != "" {
+			paragraphs = append(paragraphs, text)
+		}
+	})
+	if len(paragraphs) > 0 {
+		return strings.Join(paragraphs, "\n")
+	}
+	return strings.Join(strings.Fields(s.Text()), " ")
+}
+
+// readArticleBodies は記事のURLごとの本文を読み込む。ファイルがない場合は空で返す
+func readArticleBodies(path string) (map[string]ArticleBody, error) {
+	m := make(map[string]ArticleBody)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open file: %s", path)
+	}
+	defer f.Close()
+
+	d := json.NewDecoder(f)
+	for d.More() {
+		var body ArticleBody
+		if err := d.Decode(&body); err != nil {
+			return nil, errors.Wrapf(err, "could not unmarshal: %s", path)
+		}
+		m[body.URL] = body
+	}
+	return m, nil
+}
+
+// writeArticleBodies は記事の本文をURL順に保存する
+func writeArticleBodies(path string, m map[string]ArticleBody) error {
+	bodies := make([]ArticleBody, 0, len(m))
+	for _, b := range m {
+		bodies = append(bodies, b)
+	}
+	sort.Slice(bodies, func(i, j int) bool { return bodies[i].URL < bodies[j].URL })
+
+	f, err := createOutFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for _, b := range bodies {
+		if err := appendOutFile(f, b); err != nil {
+			return err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return errors.Wrap(err, "failed to sync file")
+	}
+	return nil
+}
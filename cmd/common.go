@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"time"
@@ -11,6 +12,7 @@ import (
 	multierror "github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 // DatesFlagFormat は`--date`フラグで用いる日付のフォーマットを表す。
@@ -21,6 +23,11 @@ type StringSliceVarSetter interface {
 	StringSliceVar(p *[]string, name string, value []string, usage string)
 }
 
+// StringVarSetter はStringフラグをセットするインタフェースを表す
+type StringVarSetter interface {
+	StringVar(p *string, name string, value string, usage string)
+}
+
 func createOutFile(path string) (*os.File, error) {
 	dir := filepath.Dir(path)
 	err := os.MkdirAll(dir, os.ModePerm)
@@ -57,31 +64,166 @@ type Content struct {
 	FormatDate string        `json:"format_date"`
 	Date       string        `json:"date"`
 	Items      []ContentItem `json:"items"`
+	// Period は集計期間。日次の場合は空
+	Period string `json:"period,omitempty"`
+	// Days は集計に含めた日 (YYYYMMDD)
+	Days []string `json:"days,omitempty"`
+	// MissingDays は記事ファイルがなく集計に含められなかった日 (YYYYMMDD)
+	MissingDays []string `json:"missing_days,omitempty"`
+	// BaselineDays は急上昇キーワードの比較対象とした日 (YYYYMMDD)
+	BaselineDays []string `json:"baseline_days,omitempty"`
+	// HistoryDays は TF-IDF の文書頻度を集計した日 (YYYYMMDD)
+	HistoryDays []string `json:"history_days,omitempty"`
+	// Trending は急上昇したキーワード。レポート生成時に TrendingFile から読み込む
+	Trending []ContentItem `json:"trending,omitempty"`
+	// TrendingFile はランキングと同時に出力した急上昇キーワードのファイル名。出力しなかった場合は空
+	TrendingFile string `json:"trending_file,omitempty"`
+	// TopicFile は急上昇キーワードやストーリーと同時に出力したランキングのファイル名
+	TopicFile string `json:"topic_file,omitempty"`
+	// Categories はカテゴリ別のランキング
+	Categories []CategoryContent `json:"categories,omitempty"`
+	// CountBy はキーワードをストーリーごとに数えた場合に story。記事ごとに数えた場合は空
+	CountBy string `json:"count_by,omitempty"`
+	// Stories は複数の見出しで報じられたストーリー。レポート生成時に StoriesFile から読み込む
+	Stories []Story `json:"stories,omitempty"`
+	// StoriesFile はランキングと同時に出力したストーリーのファイル名。出力しなかった場合は空
+	StoriesFile string `json:"stories_file,omitempty"`
+}
+
+// Unit はキーワードの数の単位を返す
+func (c Content) Unit() string {
+	if c.CountBy == "story" {
+		return "ストーリー"
+	}
+	return "記事"
+}
+
+// CategoryContent はカテゴリ別のランキングを表す
+type CategoryContent struct {
+	ID    string        `json:"id"`
+	Name  string        `json:"name"`
+	Items []ContentItem `json:"items"`
 }
 
 type ContentItem struct {
 	Word     string    `json:"word"`
 	Count    int       `json:"count"`
 	Articles []Article `json:"articles"`
+	// FeedCount は記事を掲載していたRSSの延べ数。記事が多くのRSSに掲載されているほど大きくなる
+	FeedCount int `json:"feed_count"`
+	// Variants は辞書によって Word にまとめた表記
+	Variants []string `json:"variants,omitempty"`
+	// Kind は複合名詞の場合は compound、n-gram の場合は ngram、1つの形態素の場合は空
+	Kind string `json:"kind,omitempty"`
+	// Score は `--weight tfidf` の場合の TF-IDF によるスコア
+	Score *Score `json:"score,omitempty"`
+	// Trend は急上昇キーワードの場合のベースラインとの比較結果
+	Trend *Trend `json:"trend,omitempty"`
+}
+
+// rankValue はランキングの順位付けに用いる値を返す
+func (c ContentItem) rankValue(weight string) float64 {
+	switch weight {
+	case "feeds":
+		return float64(c.FeedCount)
+	case "tfidf":
+		if c.Score != nil {
+			return c.Score.TFIDF
+		}
+	}
+	return float64(c.Count)
 }
 
 type Article struct {
 	Title string `json:"title"`
 	URL   string `json:"url"`
+	Date  string `json:"date,omitempty"`
+	// Image は記事のサムネイル画像のURL
+	Image string `json:"image,omitempty"`
+	// Snippet は記事の概要の先頭部分
+	Snippet string `json:"snippet,omitempty"`
 }
 
+// snippetLength はランキングに出力する記事の概要の最大文字数
+const snippetLength = 100
+
 type YahooRSSFeed struct {
 	ID   string `json:"id"`
 	Name string `json:"name"`
 	URL  string `json:"url"`
 }
 
+// NewsArticleJSON はRSSから抽出したニュース記事データ
 type NewsArticleJSON struct {
-	Date     string `json:"date"`
-	URL      string `json:"url"`
-	Name     string `json:"name"`
-	Title    string `json:"title"`
+	Date  string `json:"date"`
+	URL   string `json:"url"`
+	Name  string `json:"name"`
+	Title string `json:"title"`
+	// CategoryID は記事を掲載していたRSSのID
+	CategoryID string `json:"category_id"`
+	// Category は記事を掲載していたRSSの名前
 	Category string `json:"category"`
+	// Feeds は記事を掲載していた全てのRSS
+	Feeds []ArticleFeed `json:"feeds,omitempty"`
+	// FirstSeen はRSSのスナップショットで記事を最初に見つけた時刻
+	FirstSeen string `json:"first_seen,omitempty"`
+	// LastSeen はRSSのスナップショットで記事を最後に見つけた時刻
+	LastSeen string `json:"last_seen,omitempty"`
+	// Description はRSSの記事の概要からHTMLタグを取り除いたテキスト
+	Description string `json:"description,omitempty"`
+	// GUID はRSSの記事の識別子
+	GUID string `json:"guid,omitempty"`
+	// Author は記事の著者
+	Author string `json:"author,omitempty"`
+	// Categories はRSSで記事に付けられたカテゴリ
+	Categories []string `json:"categories,omitempty"`
+	// Image は記事のサムネイル画像のURL
+	Image string `json:"image,omitempty"`
+	// Body は articles コマンドで記事ページから抽出した本文。analysis で body.jsonl から読み込む
+	Body string `json:"-"`
+}
+
+// article はランキングに出力する記事を返す
+func (a NewsArticleJSON) article() Article {
+	snippet := []rune(a.Description)
+	if len(snippet) > snippetLength {
+		snippet = append(snippet[:snippetLength], '…')
+	}
+	return Article{
+		Title:   a.Title,
+		URL:     a.URL,
+		Date:    a.Date,
+		Image:   a.Image,
+		Snippet: string(snippet),
+	}
+}
+
+// ArticleFeed は記事を掲載していたRSSを表す
+type ArticleFeed struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// addFeed は記事を掲載していたRSSを重複しないように追加する
+func (a *NewsArticleJSON) addFeed(feed YahooRSSFeed) {
+	for _, f := range a.Feeds {
+		if f.ID == feed.ID {
+			return
+		}
+	}
+	a.Feeds = append(a.Feeds, ArticleFeed{ID: feed.ID, Name: feed.Name})
+}
+
+// articleFeeds は記事を掲載していたRSSを返す
+// RSSを記録する前に作成した記事データの場合はカテゴリのRSSを返す
+func (a NewsArticleJSON) articleFeeds() []ArticleFeed {
+	if len(a.Feeds) > 0 {
+		return a.Feeds
+	}
+	if a.CategoryID == "" {
+		return nil
+	}
+	return []ArticleFeed{{ID: a.CategoryID, Name: a.Category}}
 }
 
 func readYahooRSSFeed(path string) ([]YahooRSSFeed, error) {
@@ -103,6 +245,19 @@ func readYahooRSSFeed(path string) ([]YahooRSSFeed, error) {
 	return articles, nil
 }
 
+// readContent は analysis で出力したランキングのJSONファイルを読み込む
+func readContent(path string) (Content, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Content{}, errors.Wrapf(err, "failed to read file: %s", path)
+	}
+	var c Content
+	if err := json.Unmarshal(b, &c); err != nil {
+		return Content{}, errors.Wrapf(err, "could not unmarshal: %s", path)
+	}
+	return c, nil
+}
+
 func withLoggingE(fn func(*cobra.Command, []string) error) func(*cobra.Command, []string) error {
 	return func(cmd *cobra.Command, args []string) error {
 		return withLogging(fn, cmd, args)
@@ -129,13 +284,53 @@ func withLogging(fn func(cmd *cobra.Command, args []string) error, cmd *cobra.Co
 }
 
 func eachDate(date []string, fn func(time.Time) error) error {
-	step, err := getStepFunc("daily")
+	return eachPeriod(date, "daily", fn)
+}
+
+// eachPeriod は指定した日付から period ごとの期間の始めの日付について fn を実行する
+func eachPeriod(date []string, period string, fn func(time.Time) error) error {
+	step, err := getStepFunc(period)
 	if err != nil {
-		return err
+		return flagError{Message: err.Error()}
 	}
 	return eachByStep(date, step, fn)
 }
 
+// periodDays は start から始まる period の期間に含まれる日付を返す
+func periodDays(period string, start time.Time) ([]time.Time, error) {
+	step, err := getStepFunc(period)
+	if err != nil {
+		return nil, err
+	}
+	end := step(start)
+	var days []time.Time
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		days = append(days, d)
+	}
+	return days, nil
+}
+
+// periodDir は start から始まる period の期間の出力ディレクトリを dest からの相対パスで返す
+// 日次の場合は YYYYMMDD、それ以外は period/YYYYMMDD となる
+func periodDir(period string, start time.Time) string {
+	if period == "daily" {
+		return start.Format("20060102")
+	}
+	return filepath.Join(period, start.Format("20060102"))
+}
+
+// formatPeriod は期間をレポートに表示する形式で返す
+func formatPeriod(days []time.Time) string {
+	if len(days) == 0 {
+		return ""
+	}
+	first := days[0].Format("2006/01/02")
+	if len(days) == 1 {
+		return first
+	}
+	return first + "〜" + days[len(days)-1].Format("2006/01/02")
+}
+
 // getStepFunc は period に応じた対象日付の次の期間の始めの日付を取得する関数を取得する
 func getStepFunc(period string) (func(time.Time) time.Time, error) {
 	switch period {
@@ -204,6 +399,16 @@ func setDatesFlag(f StringSliceVarSetter, p *[]string, purpose string) {
 	setRangeFlag(f, p, "date", purpose)
 }
 
+func setPeriodFlag(f StringVarSetter, p *string) {
+	f.StringVar(p, "period", "daily", "aggregation period (daily, weekly, monthly, quarterly, yearly)")
+}
+
+func setFetchFlags(f *pflag.FlagSet, opts *fetchOptions) {
+	f.IntVar(&opts.concurrency, "concurrency", opts.concurrency, "number of concurrent requests")
+	f.DurationVar(&opts.interval, "interval", opts.interval, "minimum interval between requests to the same host")
+	f.DurationVar(&opts.timeout, "timeout", opts.timeout, "timeout of each request")
+}
+
 func setRangeFlag(f StringSliceVarSetter, p *[]string, name string, purpose string) {
 	const (
 		format = "%s in 'YYYYmmdd' or period in 'YYYYmmdd,YYYYmmdd' " +
@@ -233,3 +438,12 @@ func isFlagError(err error) bool {
 	_, ok := err.(flagError)
 	return ok
 }
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
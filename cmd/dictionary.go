@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/unicode/norm"
+)
+
+// keywordDictionary はキーワードを集計する前に適用するストップワードと表記揺れの辞書を表す
+// 表記は NFKC 正規化して小文字にしてから照合するので、全角・半角の違いは登録しなくてよい
+type keywordDictionary struct {
+	stopwords map[string]bool
+	// aliases は表記から正規の表記への対応
+	aliases map[string]string
+}
+
+// keywordDictionaryJSON は辞書ファイルの形式を表す
+//
+//	{"stopwords": ["速報"], "aliases": {"菅義偉": ["菅", "菅首相"]}}
+type keywordDictionaryJSON struct {
+	Stopwords []string `json:"stopwords"`
+	// Aliases は正規の表記から、まとめる表記のリストへの対応
+	Aliases map[string][]string `json:"aliases"`
+}
+
+// newKeywordDictionary は辞書ファイルを読み込む。path が空の場合は空の辞書を返す
+func newKeywordDictionary(path string) (*keywordDictionary, error) {
+	d := &keywordDictionary{
+		stopwords: make(map[string]bool),
+		aliases:   make(map[string]string),
+	}
+	if path == "" {
+		return d, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read dictionary file: %s", path)
+	}
+	var j keywordDictionaryJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return nil, errors.Wrapf(err, "could not unmarshal: %s", path)
+	}
+	for _, w := range j.Stopwords {
+		d.stopwords[dictionaryKey(w)] = true
+	}
+	// 同じ表記が複数の正規の表記に登録されている場合に毎回同じエラーになるよう、正規の表記の順に登録する
+	canonicals := make([]string, 0, len(j.Aliases))
+	for canonical := range j.Aliases {
+		canonicals = append(canonicals, canonical)
+	}
+	sort.Strings(canonicals)
+	for _, canonical := range canonicals {
+		if err := d.addAlias(canonical, canonical); err != nil {
+			return nil, err
+		}
+		for _, v := range j.Aliases[canonical] {
+			if err := d.addAlias(v, canonical); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return d, nil
+}
+
+// addAlias は表記 v を正規の表記 canonical に対応付ける。v が別の正規の表記に登録済みの場合はエラーを返す
+func (d *keywordDictionary) addAlias(v, canonical string) error {
+	key := dictionaryKey(v)
+	if c, ok := d.aliases[key]; ok && c != canonical {
+		return errors.Errorf("alias %q is registered for both %q and %q", v, c, canonical)
+	}
+	d.aliases[key] = canonical
+	return nil
+}
+
+// canonical は表記を正規の表記に変換する。ストップワードの場合は false を返す
+func (d *keywordDictionary) canonical(surface string) (string, bool) {
+	key := dictionaryKey(surface)
+	if d.stopwords[key] {
+		return "", false
+	}
+	if c, ok := d.aliases[key]; ok {
+		return c, true
+	}
+	return surface, true
+}
+
+func dictionaryKey(s string) string {
+	return strings.ToLower(norm.NFKC.String(strings.TrimSpace(s)))
+}
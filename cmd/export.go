@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// exportFormats は `--format` フラグに指定できる出力形式
+var exportFormats = []string{"csv", "tsv"}
+
+// exportHeader は出力するファイルの見出し行
+var exportHeader = []string{"date", "rank", "word", "count", "title", "url", "category"}
+
+// utf8BOM は表計算ソフトに UTF-8 と判定させるためにファイルの先頭に付ける BOM
+const utf8BOM = "\ufeff"
+
+// exportOptions はランキングの CSV/TSV 出力の設定を表す
+type exportOptions struct {
+	// format は出力形式 (csv, tsv)
+	format string
+	// outFile は出力するファイル名。空の場合は ranking.csv または ranking.tsv
+	outFile string
+	// topicFile は読み込むランキングのファイル名
+	topicFile string
+	// bom はファイルの先頭に UTF-8 の BOM を付ける場合に true
+	bom bool
+}
+
+func defaultExportOptions() exportOptions {
+	return exportOptions{
+		format:    "csv",
+		topicFile: "topic.json",
+	}
+}
+
+// exportRankings は dates の各日のランキングを、キーワードと記事の組ごとに1行として dest/outFile に出力する
+// 記事のカテゴリは src/YYYYMMDD/rss.jsonl から引く。ランキングのない日は読み飛ばす
+// 値にカンマや引用符、改行が含まれる場合は RFC 4180 に従って引用符で囲む
+func exportRankings(src, dest string, dates []string, opts exportOptions) error {
+	outFile := opts.outFile
+	if outFile == "" {
+		outFile = "ranking." + opts.format
+	}
+	path := filepath.Join(dest, outFile)
+	f, err := createOutFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if opts.bom {
+		if _, err := f.WriteString(utf8BOM); err != nil {
+			return errors.Wrapf(err, "failed to write file: %s", path)
+		}
+	}
+	w := csv.NewWriter(f)
+	if opts.format == "tsv" {
+		w.Comma = '\t'
+	} else {
+		// RFC 4180 に従って行を CRLF で区切る
+		w.UseCRLF = true
+	}
+	if err := w.Write(exportHeader); err != nil {
+		return errors.Wrapf(err, "failed to write file: %s", path)
+	}
+
+	err = eachDate(dates, func(date time.Time) error {
+		rows, err := exportRows(src, date, opts.topicFile)
+		if err != nil {
+			return err
+		}
+		if err := w.WriteAll(rows); err != nil {
+			return errors.Wrapf(err, "failed to write file: %s", path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return errors.Wrapf(err, "failed to write file: %s", path)
+	}
+	if err := f.Sync(); err != nil {
+		return errors.Wrap(err, "failed to sync file")
+	}
+	return nil
+}
+
+// exportRows は date のランキングをキーワードと記事の組ごとの行にする
+func exportRows(src string, date time.Time, topicFile string) ([][]string, error) {
+	dateStr := date.Format("20060102")
+	c, ok, err := readOptionalContent(src, dateStr, topicFile)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		fmt.Println("ranking file not found.", zap.String("path", filepath.Join(src, dateStr, topicFile)))
+		return nil, nil
+	}
+
+	categories := make(map[string]string)
+	articlesPath := filepath.Join(src, dateStr, "rss.jsonl")
+	articles, err := readArticles(articlesPath)
+	if err != nil {
+		// カテゴリがなくてもランキングは出力するので warnnig log を出力する
+		fmt.Println("failed to open JSONL file.", zap.String("path", articlesPath), zap.Error(err))
+	}
+	for _, a := range articles {
+		categories[a.URL] = a.Category
+	}
+
+	var rows [][]string
+	day := date.Format("2006-01-02")
+	for i, item := range c.Items {
+		for _, a := range item.Articles {
+			rows = append(rows, []string{
+				day,
+				strconv.Itoa(i + 1),
+				item.Word,
+				strconv.Itoa(item.Count),
+				a.Title,
+				a.URL,
+				categories[a.URL],
+			})
+		}
+	}
+	return rows, nil
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// feedModes は `--mode` フラグに指定できるフィードのエントリの単位
+var feedModes = []string{"daily", "trending"}
+
+// feedOptions はランキングのフィード生成の設定を表す
+type feedOptions struct {
+	// mode はエントリの単位 (daily: 1日ごと, trending: 急上昇キーワードごと)
+	mode string
+	// title はフィードのタイトル
+	title string
+	// baseURL はサイトのURL。エントリのリンクはこのURLからの相対パスとする
+	baseURL string
+	// linkFormat は日付 (YYYYMMDD) からエントリのリンクの相対パスを作るフォーマット
+	linkFormat string
+	// days はフィードに含める直近の日数。0 の場合は全ての日を含める
+	days int
+	// items は1日のエントリに含めるキーワードの最大数
+	items int
+	// topicFile は読み込むランキングのファイル名
+	topicFile string
+	// trendingFile は trending の場合に読み込む急上昇キーワードのファイル名
+	trendingFile string
+}
+
+func defaultFeedOptions() feedOptions {
+	return feedOptions{
+		mode:         "daily",
+		title:        "Yahoo!ニュース キーワードランキング",
+		linkFormat:   "days/%s.html",
+		days:         30,
+		items:        10,
+		topicFile:    "topic.json",
+		trendingFile: "trending.json",
+	}
+}
+
+// feedEntry はフィードの1エントリを表す
+type feedEntry struct {
+	ID    string
+	Title string
+	URL   string
+	Date  time.Time
+	HTML  string
+	Text  string
+	Tags  []string
+}
+
+// feed はフィードの内容を表す
+type feed struct {
+	Title   string
+	HomeURL string
+	// FeedURL は形式ごとのフィードのURL
+	FeedURL map[string]string
+	Updated time.Time
+	Entries []feedEntry
+}
+
+// feedFileNames はフィードの形式ごとの出力ファイル名
+var feedFileNames = map[string]string{
+	"atom": "atom.xml",
+	"rss":  "rss.xml",
+	"json": "feed.json",
+}
+
+// generateFeed は src 直下の YYYYMMDD/topic.json からランキングのフィードを生成して、Atom、RSS 2.0、JSON Feed 1.1 で dest に出力する
+// エントリは新しい順に並べ、daily の場合は1日ごと、trending の場合は trending.json の急上昇キーワードごとのエントリとする
+func generateFeed(src, dest string, opts feedOptions) error {
+	days, err := readSiteDays(src, opts.topicFile)
+	if err != nil {
+		return err
+	}
+	if len(days) == 0 {
+		return errors.Errorf("no %s found in %s", opts.topicFile, src)
+	}
+	if opts.days > 0 && len(days) > opts.days {
+		days = days[len(days)-opts.days:]
+	}
+
+	f := feed{
+		Title:   opts.title,
+		HomeURL: feedURL(opts.baseURL, "index.html"),
+		FeedURL: make(map[string]string),
+	}
+	for format, fileName := range feedFileNames {
+		f.FeedURL[format] = feedURL(opts.baseURL, fileName)
+	}
+	for i := len(days) - 1; i >= 0; i-- {
+		day := days[i]
+		link := feedURL(opts.baseURL, fmt.Sprintf(opts.linkFormat, day.Name))
+		if opts.mode != "trending" {
+			f.Entries = append(f.Entries, dailyFeedEntry(day, link, opts.items))
+			continue
+		}
+		t, ok, err := readOptionalContent(src, day.Name, opts.trendingFile)
+		if err != nil {
+			return err
+		}
+		if ok {
+			f.Entries = append(f.Entries, trendingFeedEntries(day, t, link)...)
+		}
+	}
+	f.Updated = days[len(days)-1].Date
+
+	writers := []struct {
+		format string
+		write  func(io.Writer, feed) error
+	}{
+		{format: "atom", write: writeAtom},
+		{format: "rss", write: writeRSS},
+		{format: "json", write: writeJSONFeed},
+	}
+	for _, w := range writers {
+		path := filepath.Join(dest, feedFileNames[w.format])
+		out, err := createOutFile(path)
+		if err != nil {
+			return err
+		}
+		if err := w.write(out, f); err != nil {
+			out.Close()
+			return errors.Wrapf(err, "failed to write feed: %s", path)
+		}
+		if err := out.Sync(); err != nil {
+			out.Close()
+			return errors.Wrap(err, "failed to sync file")
+		}
+		if err := out.Close(); err != nil {
+			return errors.Wrapf(err, "failed to close file: %s", path)
+		}
+	}
+	return nil
+}
+
+// feedURL はサイトのURLと相対パスをつなげる
+func feedURL(baseURL, path string) string {
+	return strings.TrimSuffix(baseURL, "/") + "/" + path
+}
+
+// dailyFeedEntry は1日のランキングの上位 n 件を1つのエントリにする
+func dailyFeedEntry(day *siteDay, link string, n int) feedEntry {
+	items := limitItems(day.Content.Items, n)
+	var h, text strings.Builder
+	var tags []string
+	h.WriteString("<ol>")
+	for i, item := range items {
+		fmt.Fprintf(&h, "<li>%s (%d%s)</li>", html.EscapeString(item.Word), item.Count, day.Content.Unit())
+		if i > 0 {
+			text.WriteString("、")
+		}
+		fmt.Fprintf(&text, "%d位 %s (%d%s)", i+1, item.Word, item.Count, day.Content.Unit())
+		tags = append(tags, item.Word)
+	}
+	h.WriteString("</ol>")
+
+	title := day.Content.FormatDate + " に話題になったキーワード"
+	if len(items) > 0 {
+		title += ": " + strings.Join(tags[:minInt(3, len(tags))], "、")
+	}
+	return feedEntry{
+		ID:    link,
+		Title: title,
+		URL:   link,
+		Date:  day.Date,
+		HTML:  h.String(),
+		Text:  text.String(),
+		Tags:  tags,
+	}
+}
+
+// trendingFeedEntries は1日の急上昇キーワードをそれぞれエントリにする
+func trendingFeedEntries(day *siteDay, trending Content, link string) []feedEntry {
+	var ret []feedEntry
+	for _, item := range trending.Items {
+		var h strings.Builder
+		h.WriteString("<ul>")
+		for _, a := range item.Articles {
+			fmt.Fprintf(&h, `<li><a href="%s">%s</a></li>`, html.EscapeString(a.URL), html.EscapeString(a.Title))
+		}
+		h.WriteString("</ul>")
+
+		text := fmt.Sprintf("%d%s", item.Count, trending.Unit())
+		if item.Trend != nil {
+			text += fmt.Sprintf("、スコア %.2f", item.Trend.Score)
+		}
+		ret = append(ret, feedEntry{
+			ID:    link + "#" + item.Word,
+			Title: fmt.Sprintf("%s の急上昇キーワード: %s", day.Content.FormatDate, item.Word),
+			URL:   link,
+			Date:  day.Date,
+			HTML:  "<p>" + html.EscapeString(text) + "</p>" + h.String(),
+			Text:  text,
+			Tags:  []string{item.Word},
+		})
+	}
+	return ret
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Updated    string         `xml:"updated"`
+	Link       atomLink       `xml:"link"`
+	Categories []atomCategory `xml:"category"`
+	Summary    string         `xml:"summary"`
+	Content    atomContent    `xml:"content"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// writeAtom は Atom 形式で出力する
+func writeAtom(w io.Writer, f feed) error {
+	doc := atomFeed{
+		Title:   f.Title,
+		ID:      f.HomeURL,
+		Updated: f.Updated.Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: f.HomeURL},
+			{Href: f.FeedURL["atom"], Rel: "self", Type: "application/atom+xml"},
+		},
+		Author: atomAuthor{Name: f.Title},
+	}
+	for _, e := range f.Entries {
+		entry := atomEntry{
+			Title:   e.Title,
+			ID:      e.ID,
+			Updated: e.Date.Format(time.RFC3339),
+			Link:    atomLink{Href: e.URL},
+			Summary: e.Text,
+			Content: atomContent{Type: "html", Body: e.HTML},
+		}
+		for _, tag := range e.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+	return writeXML(w, doc)
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// writeRSS は RSS 2.0 形式で出力する
+func writeRSS(w io.Writer, f feed) error {
+	doc := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         f.Title,
+			Link:          f.HomeURL,
+			Description:   f.Title,
+			LastBuildDate: f.Updated.Format(time.RFC1123Z),
+		},
+	}
+	for _, e := range f.Entries {
+		doc.Channel.Items = append(doc.Channel.Items, rssItem{
+			Title:       e.Title,
+			Link:        e.URL,
+			GUID:        rssGUID{IsPermaLink: e.ID == e.URL, Value: e.ID},
+			PubDate:     e.Date.Format(time.RFC1123Z),
+			Categories:  e.Tags,
+			Description: e.HTML,
+		})
+	}
+	return writeXML(w, doc)
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string   `json:"id"`
+	URL           string   `json:"url"`
+	Title         string   `json:"title"`
+	ContentHTML   string   `json:"content_html"`
+	ContentText   string   `json:"content_text"`
+	DatePublished string   `json:"date_published"`
+	Tags          []string `json:"tags,omitempty"`
+}
+
+// writeJSONFeed は JSON Feed 1.1 形式で出力する
+func writeJSONFeed(w io.Writer, f feed) error {
+	doc := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       f.Title,
+		HomePageURL: f.HomeURL,
+		FeedURL:     f.FeedURL["json"],
+		Items:       []jsonFeedItem{},
+	}
+	for _, e := range f.Entries {
+		doc.Items = append(doc.Items, jsonFeedItem{
+			ID:            e.ID,
+			URL:           e.URL,
+			Title:         e.Title,
+			ContentHTML:   e.HTML,
+			ContentText:   e.Text,
+			DatePublished: e.Date.Format(time.RFC3339),
+			Tags:          e.Tags,
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// fetchOptions はHTTP取得の設定を表す
+type fetchOptions struct {
+	// maxRetry はリクエストに失敗した場合のリトライ回数
+	maxRetry uint
+	// retryWait はリトライするまでの待ち時間
+	retryWait time.Duration
+	// concurrency は同時にリクエストする数
+	concurrency int
+	// interval は同じホストへリクエストする間隔
+	interval time.Duration
+	// timeout は1リクエストのタイムアウト
+	timeout time.Duration
+}
+
+func defaultFetchOptions() fetchOptions {
+	return fetchOptions{
+		maxRetry:    MAX_RETRY,
+		retryWait:   3 * time.Second,
+		concurrency: 4,
+		interval:    500 * time.Millisecond,
+		timeout:     30 * time.Second,
+	}
+}
+
+// fetcher はホストごとにリクエストの間隔を空けてHTTP取得する
+// 複数の goroutine から同時に利用できる
+type fetcher struct {
+	client  *http.Client
+	limiter *hostLimiter
+	opts    fetchOptions
+}
+
+func newFetcher(opts fetchOptions) *fetcher {
+	return &fetcher{
+		client:  &http.Client{Timeout: opts.timeout},
+		limiter: newHostLimiter(opts.interval),
+		opts:    opts,
+	}
+}
+
+// do はリクエストを送信し、通信に失敗した場合は maxRetry 回までリトライする
+func (f *fetcher) do(req *http.Request) (res *http.Response, err error) {
+	retry := uint(0)
+	for {
+		f.limiter.wait(req.URL)
+		res, err = f.client.Do(req)
+		retry++
+		if err == nil || retry > f.opts.maxRetry {
+			break
+		}
+		time.Sleep(f.opts.retryWait)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed request url : %s", req.URL)
+	}
+	return res, nil
+}
+
+// hostLimiter はホストごとにリクエストの間隔を空ける
+type hostLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next map[string]time.Time
+}
+
+func newHostLimiter(interval time.Duration) *hostLimiter {
+	return &hostLimiter{
+		interval: interval,
+		next:     make(map[string]time.Time),
+	}
+}
+
+// wait は u のホストへ前回リクエストしてから interval が経過するまで待つ
+func (l *hostLimiter) wait(u *url.URL) {
+	l.mu.Lock()
+	now := time.Now()
+	t := l.next[u.Host]
+	if t.Before(now) {
+		t = now
+	}
+	l.next[u.Host] = t.Add(l.interval)
+	l.mu.Unlock()
+
+	time.Sleep(time.Until(t))
+}
+
+// parallel は fn(0) から fn(n-1) を最大 concurrency 並列で実行する
+func parallel(n, concurrency int, fn func(i int)) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CooccurrenceGraph は同じタイトルに現れたキーワードの共起グラフを表す
+type CooccurrenceGraph struct {
+	FormatDate string             `json:"format_date"`
+	Date       string             `json:"date"`
+	Nodes      []CooccurrenceNode `json:"nodes"`
+	Edges      []CooccurrenceEdge `json:"edges"`
+}
+
+// CooccurrenceNode はキーワードを表す
+type CooccurrenceNode struct {
+	ID    string `json:"id"`
+	Count int    `json:"count"`
+}
+
+// CooccurrenceEdge は2つのキーワードが同じタイトルに現れたことを表す
+// Source と Target はキーワード順で、Weight は両方のキーワードが現れた記事数
+type CooccurrenceEdge struct {
+	Source   string    `json:"source"`
+	Target   string    `json:"target"`
+	Weight   int       `json:"weight"`
+	Articles []Article `json:"articles"`
+}
+
+// toCooccurrenceGraph はランキングのキーワードをノードとして、同じタイトルに現れたキーワードの間にエッジを張る
+func toCooccurrenceGraph(articles []NewsArticleJSON, ex *keywordExtractor, items []ContentItem) (CooccurrenceGraph, error) {
+	var g CooccurrenceGraph
+	ranked := make(map[string]bool, len(items))
+	for _, item := range items {
+		ranked[item.Word] = true
+		g.Nodes = append(g.Nodes, CooccurrenceNode{ID: item.Word, Count: item.Count})
+	}
+
+	edges := make(map[[2]string]*CooccurrenceEdge)
+	for _, article := range articles {
+		keywords, err := ex.extract(article.Title)
+		if err != nil {
+			return CooccurrenceGraph{}, err
+		}
+		var words []string
+		for _, k := range keywords {
+			if ranked[k.word] && !contains(words, k.word) {
+				words = append(words, k.word)
+			}
+		}
+		sort.Strings(words)
+		for i := 0; i < len(words); i++ {
+			for j := i + 1; j < len(words); j++ {
+				key := [2]string{words[i], words[j]}
+				e, ok := edges[key]
+				if !ok {
+					e = &CooccurrenceEdge{Source: words[i], Target: words[j]}
+					edges[key] = e
+				}
+				e.Weight++
+				e.Articles = append(e.Articles, article.article())
+			}
+		}
+	}
+
+	for _, e := range edges {
+		sortArticles(e.Articles)
+		g.Edges = append(g.Edges, *e)
+	}
+	sort.Slice(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i], g.Edges[j]
+		if a.Weight != b.Weight {
+			return a.Weight > b.Weight
+		}
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		return a.Target < b.Target
+	})
+	return g, nil
+}
+
+// writeCooccurrenceGraph は共起グラフを JSON、GraphML、Graphviz DOT の各形式で出力する
+func writeCooccurrenceGraph(dest, dir, baseName string, g CooccurrenceGraph) error {
+	writers := []struct {
+		ext   string
+		write func(io.Writer, CooccurrenceGraph) error
+	}{
+		{ext: ".json", write: func(w io.Writer, g CooccurrenceGraph) error {
+			jsonStr, err := toJSON(g)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(w, jsonStr)
+			return err
+		}},
+		{ext: ".graphml", write: writeGraphML},
+		{ext: ".dot", write: writeDOT},
+	}
+	for _, w := range writers {
+		path := filepath.Join(dest, dir, baseName+w.ext)
+		f, err := createOutFile(path)
+		if err != nil {
+			return err
+		}
+		if err := w.write(f, g); err != nil {
+			f.Close()
+			return errors.Wrapf(err, "failed to write graph: %s", path)
+		}
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return errors.Wrap(err, "failed to sync file")
+		}
+		if err := f.Close(); err != nil {
+			return errors.Wrapf(err, "failed to close file: %s", path)
+		}
+	}
+	return nil
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// writeGraphML は Gephi などで読み込める GraphML 形式で出力する
+func writeGraphML(w io.Writer, g CooccurrenceGraph) error {
+	doc := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "label", For: "node", AttrName: "label", AttrType: "string"},
+			{ID: "count", For: "node", AttrName: "count", AttrType: "int"},
+			{ID: "weight", For: "edge", AttrName: "weight", AttrType: "int"},
+		},
+		Graph: graphMLGraph{EdgeDefault: "undirected"},
+	}
+	for _, n := range g.Nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{
+			ID: n.ID,
+			Data: []graphMLData{
+				{Key: "label", Value: n.ID},
+				{Key: "count", Value: fmt.Sprint(n.Count)},
+			},
+		})
+	}
+	for _, e := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			Source: e.Source,
+			Target: e.Target,
+			Data:   []graphMLData{{Key: "weight", Value: fmt.Sprint(e.Weight)}},
+		})
+	}
+
+	return writeXML(w, doc)
+}
+
+// writeDOT は Graphviz で描画できる DOT 形式で出力する
+func writeDOT(w io.Writer, g CooccurrenceGraph) error {
+	var b strings.Builder
+	b.WriteString("graph cooccurrence {\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&b, "  %s [label=%s, count=%d];\n", dotQuote(n.ID), dotQuote(fmt.Sprintf("%s (%d)", n.ID, n.Count)), n.Count)
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "  %s -- %s [weight=%d, penwidth=%d];\n", dotQuote(e.Source), dotQuote(e.Target), e.Weight, e.Weight)
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
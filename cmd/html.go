@@ -0,0 +1,106 @@
+package main
+
+// reportFormats は `--format` フラグに指定できるレポートの形式
+var reportFormats = []string{"markdown", "html"}
+
+// reportFileNames はレポートの形式ごとの既定の出力ファイル名
+var reportFileNames = map[string]string{
+	"markdown": "report.md",
+	"html":     "report.html",
+}
+
+// builtinReportTemplates はレポートの形式ごとの組み込みのテンプレート
+var builtinReportTemplates = map[string]string{
+	"markdown": tmplStr,
+	"html":     htmlTmplStr,
+}
+
+// htmlTmplStr はブラウザで直接開ける1ファイルのHTMLレポートのテンプレート
+// カテゴリ別のランキングはタブで切り替え、キーワードごとの記事は折りたたんで表示する
+const htmlTmplStr = `<!DOCTYPE html>
+<html lang="ja">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{ .FormatDate }} に話題になったキーワードランキング</title>
+<style>
+body { font-family: sans-serif; line-height: 1.6; max-width: 960px; margin: 0 auto; padding: 1em; color: #222; }
+h1 { font-size: 1.5em; }
+h2 { font-size: 1.25em; border-bottom: 1px solid #ddd; margin-top: 2em; }
+.meta { color: #666; font-size: 0.9em; }
+ol.ranking { padding-left: 2.5em; }
+ol.ranking > li { margin: 0.25em 0; }
+summary { cursor: pointer; }
+summary .word { font-weight: bold; }
+summary .count { color: #666; font-size: 0.9em; margin-left: 0.5em; }
+details ul { margin: 0.25em 0 0.75em; }
+.article img { display: block; max-width: 160px; margin: 0.25em 0; }
+.article .snippet { color: #555; font-size: 0.9em; }
+.tabs > input { display: none; }
+.tabs > label { display: inline-block; padding: 0.25em 0.75em; margin: 0 0.25em 0.25em 0; border: 1px solid #ccc; border-radius: 4px 4px 0 0; cursor: pointer; background: #f5f5f5; }
+.tabs > input:checked + label { background: #fff; border-bottom-color: #fff; font-weight: bold; }
+.tabs .panel { display: none; border-top: 1px solid #ccc; }
+{{ range $i, $tab := .Tabs -}}
+#tab-{{ $i }}:checked ~ .panels #panel-{{ $i }} { display: block; }
+{{ end -}}
+</style>
+</head>
+<body>
+<h1>{{ .FormatDate }} に話題になったキーワードランキング</h1>
+{{ if .Period -}}
+<p class="meta">集計日: {{ join .Days ", " }}</p>
+{{ if .MissingDays -}}
+<p class="meta">記事ファイルがなく集計に含まれていない日: {{ join .MissingDays ", " }}</p>
+{{ end -}}
+{{ end -}}
+{{ if .Trending -}}
+<h2>急上昇したキーワード</h2>
+<ol class="ranking">
+{{ range .Trending -}}
+<li><details><summary><span class="word">{{ .Word }}</span><span class="count">{{ .Count }}{{ $.Unit }}、スコア {{ printf "%.2f" .Trend.Score }}</span></summary>
+{{ template "articles" .Articles }}
+</details></li>
+{{ end -}}
+</ol>
+{{ end -}}
+<h2>多く言及されたキーワード</h2>
+<div class="tabs">
+{{ range $i, $tab := .Tabs -}}
+<input type="radio" name="tab" id="tab-{{ $i }}"{{ if eq $i 0 }} checked{{ end }}><label for="tab-{{ $i }}">{{ $tab.Name }}</label>
+{{ end -}}
+<div class="panels">
+{{ range $i, $tab := .Tabs -}}
+<div class="panel" id="panel-{{ $i }}">
+<ol class="ranking">
+{{ range $tab.Items -}}
+<li><details><summary><span class="word">{{ .Word }}</span><span class="count">{{ .Count }}{{ $.Unit }}{{ if .Score }}、TF-IDF {{ printf "%.2f" .Score.TFIDF }}{{ end }}</span></summary>
+{{ template "articles" .Articles }}
+</details></li>
+{{ end -}}
+</ol>
+</div>
+{{ end -}}
+</div>
+</div>
+{{ if .Stories -}}
+<h2>複数の見出しで報じられたニュース</h2>
+<ol class="ranking">
+{{ range .Stories -}}
+<li><details><summary><span class="word">{{ .Title }}</span><span class="count">{{ len .Articles }}記事</span></summary>
+{{ template "articles" .Articles }}
+</details></li>
+{{ end -}}
+</ol>
+{{ end -}}
+</body>
+</html>
+{{- define "articles" -}}
+<ul>
+{{ range . -}}
+<li class="article"><a href="{{ .URL }}">{{ .Title }}</a>
+{{- with .Image }}<img src="{{ . }}" alt="" loading="lazy">{{ end }}
+{{- with .Snippet }}<div class="snippet">{{ . }}</div>{{ end }}</li>
+{{ end -}}
+</ul>
+{{- end }}
+`
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -9,9 +11,39 @@ import (
 const MAX_RETRY = 3
 
 var (
-	dates []string
-	src   string
-	dest  string
+	dates    []string
+	src      string
+	dest     string
+	fetchDir string
+	force    bool
+
+	tokenizerName string
+	posNames      []string
+	posFile       string
+	topicFile     string
+	reportFile    string
+	period        string
+	trend         trendOptions
+	fetch         = defaultFetchOptions()
+	weight        string
+	titleRules    string
+	samples       int
+	dictionary    string
+	top           int
+	minCount      int
+	compoundMax   int
+	ngram         int
+	historyDays   int
+	graphFile     string
+	story         storyOptions
+	description   bool
+	thumbnails    bool
+	snippets      bool
+	textSource    string
+	selectors     []string
+	reportFormat  string
+	templates     []string
+	templateName  string
 )
 
 func newFetchYahooNewsCommand() *cobra.Command {
@@ -36,7 +68,7 @@ func newFetchRSSCommand() *cobra.Command {
 		Use:   "rss",
 		Short: "Fetch yahoo news rss file",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			err := fetchYahooNewsRSS(src, dest, MAX_RETRY)
+			err := fetchYahooNewsRSS(src, dest, fetch)
 			if err != nil {
 				return err
 			}
@@ -45,6 +77,7 @@ func newFetchRSSCommand() *cobra.Command {
 	}
 	cmd.PersistentFlags().StringVar(&src, "src", "~/Desktop", "src dir path")
 	cmd.PersistentFlags().StringVar(&dest, "dest", "~/Desktop", "dest dir path")
+	setFetchFlags(cmd.Flags(), &fetch)
 
 	return cmd
 }
@@ -67,18 +100,125 @@ func newTransformJsonCommand() *cobra.Command {
 	return cmd
 }
 
+func newFetchArticlesCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "articles",
+		Short: "Fetch article pages listed in yahoo news json file and extract their bodies",
+		RunE: withLoggingE(func(cmd *cobra.Command, args []string) error {
+			opts := articleBodyOptions{
+				fetch:     fetch,
+				selectors: selectors,
+				force:     force,
+			}
+			return eachDate(dates, func(date time.Time) error {
+				return fetchArticleBodies(src, dest, date, opts)
+			})
+		}),
+	}
+	cmd.PersistentFlags().StringVar(&src, "src", "~/Desktop", "src dir path")
+	cmd.PersistentFlags().StringVar(&dest, "dest", "~/Desktop", "dest dir path")
+	setFetchFlags(cmd.Flags(), &fetch)
+	cmd.Flags().StringSliceVar(&selectors, "selector", defaultBodySelectors, "CSS selectors of article bodies tried in order")
+	cmd.Flags().BoolVar(&force, "force", false, "refetch articles already saved")
+	setDatesFlag(cmd.Flags(), &dates, "target date")
+	_ = cmd.MarkFlagRequired("date")
+
+	return cmd
+}
+
 func newTransformAnalysisCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "analysis",
 		Short: "Transform yahoo news json file to mecab analysis",
 		RunE: withLoggingE(func(cmd *cobra.Command, args []string) error {
-			return eachDate(dates, func(date time.Time) error {
-				return transformAnalysis(src, dest, date)
+			filter, err := newPOSFilter(posNames, posFile)
+			if err != nil {
+				return err
+			}
+			opts := analysisOptions{
+				tokenizer:   tokenizerName,
+				posFilter:   filter,
+				topicFile:   topicFile,
+				period:      period,
+				trend:       trend,
+				weight:      weight,
+				titleRules:  titleRules,
+				dictionary:  dictionary,
+				top:         top,
+				minCount:    minCount,
+				compoundMax: compoundMax,
+				ngram:       ngram,
+				historyDays: historyDays,
+				graphFile:   graphFile,
+				story:       story,
+				description: description,
+				text:        textSource,
+			}
+			if !contains(rankWeights, weight) {
+				return flagError{Message: "invalid weight: %s", Args: []interface{}{weight}}
+			}
+			if !contains(textSources, textSource) {
+				return flagError{Message: "invalid text: %s", Args: []interface{}{textSource}}
+			}
+			if !contains(countUnits, story.countBy) {
+				return flagError{Message: "invalid count unit: %s", Args: []interface{}{story.countBy}}
+			}
+			if story.similarity <= 0 || story.similarity > 1 {
+				return flagError{Message: "story similarity must be greater than 0 and at most 1: %v", Args: []interface{}{story.similarity}}
+			}
+			if !contains(trendMetrics, trend.metric) {
+				return flagError{Message: "invalid trend metric: %s", Args: []interface{}{trend.metric}}
+			}
+			ex, err := newKeywordExtractor(opts)
+			if err != nil {
+				return err
+			}
+			defer ex.close()
+			// 急上昇キーワードと TF-IDF で参照する過去の日は対象日付の間で重なるので、集計結果を全ての対象日付で共有する
+			counter := newDayCounter(src, ex)
+			return eachPeriod(dates, period, func(date time.Time) error {
+				return analyzePeriod(src, dest, date, opts, ex, counter)
 			})
 		}),
 	}
 	cmd.PersistentFlags().StringVar(&src, "src", "~/Desktop", "src dir path")
 	cmd.PersistentFlags().StringVar(&dest, "dest", "~/Desktop", "src dir path")
+	cmd.Flags().StringVar(&tokenizerName, "tokenizer", "mecab",
+		fmt.Sprintf("morphological analyzer (%s)", strings.Join(tokenizerNames, ", ")))
+	cmd.Flags().StringArrayVar(&posNames, "pos", nil,
+		"pos preset (person, organization, place, all-proper-nouns) or pattern like '名詞,固有名詞,*,一般' (repeatable, default person)")
+	cmd.Flags().StringVar(&posFile, "pos-file", "", "JSON file defining additional pos presets")
+	cmd.Flags().StringVar(&titleRules, "title-rules", "", "JSON file of title normalization rules (default built-in rules)")
+	cmd.Flags().StringVar(&dictionary, "dict", "", "JSON file of stopwords and aliases")
+	cmd.Flags().StringVar(&topicFile, "topic", "topic.json", "output ranking file name")
+	cmd.Flags().IntVar(&top, "top", 30, "maximum number of keywords in each ranking (0 for unlimited)")
+	cmd.Flags().IntVar(&minCount, "min-count", 1, "minimum number of articles for a keyword to be ranked")
+	cmd.Flags().IntVar(&compoundMax, "compound-max", 0, "also rank runs of adjacent nouns as compound keywords, splitting longer runs into windows of this many tokens (0 to disable)")
+	cmd.Flags().IntVar(&ngram, "ngram", 0, "also rank token n-grams of this size (0 to disable)")
+	cmd.Flags().BoolVar(&description, "description", false, "also extract keywords from article descriptions")
+	cmd.Flags().StringVar(&textSource, "text", "title",
+		fmt.Sprintf("text to extract keywords from (%s); body requires the articles command", strings.Join(textSources, ", ")))
+	cmd.Flags().StringVar(&graphFile, "graph", "",
+		"also write a keyword co-occurrence graph as <name>.json, <name>.graphml and <name>.dot (e.g. graph)")
+	setPeriodFlag(cmd.Flags(), &period)
+	cmd.Flags().StringVar(&weight, "weight", "articles",
+		fmt.Sprintf("value used to rank keywords (%s)", strings.Join(rankWeights, ", ")))
+	cmd.Flags().IntVar(&historyDays, "history-days", 30, "number of preceding days used for document frequencies of --weight tfidf")
+	d := defaultTrendOptions()
+	cmd.Flags().BoolVar(&trend.enabled, "trending", false, "detect trending keywords compared with the preceding days")
+	cmd.Flags().IntVar(&trend.baselineDays, "baseline-days", d.baselineDays, "number of preceding days used as the trending baseline")
+	cmd.Flags().StringVar(&trend.metric, "trend-metric", d.metric,
+		fmt.Sprintf("trending score (%s)", strings.Join(trendMetrics, ", ")))
+	cmd.Flags().Float64Var(&trend.threshold, "trend-threshold", d.threshold, "minimum score of trending keywords")
+	cmd.Flags().StringVar(&trend.trendingFile, "trending-file", d.trendingFile, "output trending file name")
+	s := defaultStoryOptions()
+	cmd.Flags().BoolVar(&story.enabled, "stories", false, "group near-duplicate headlines into stories and write them out")
+	cmd.Flags().StringVar(&story.countBy, "count-by", s.countBy,
+		fmt.Sprintf("count each keyword once per (%s)", strings.Join(countUnits, ", ")))
+	cmd.Flags().Float64Var(&story.similarity, "story-similarity", s.similarity,
+		"minimum Jaccard similarity of headline character n-grams to group articles into a story")
+	cmd.Flags().IntVar(&story.ngram, "story-ngram", s.ngram, "size of character n-grams compared between headlines")
+	cmd.Flags().StringVar(&story.storiesFile, "stories-file", s.storiesFile, "output stories file name")
 	setDatesFlag(cmd.Flags(), &dates, "target date")
 	_ = cmd.MarkFlagRequired("date")
 
@@ -91,8 +231,24 @@ func newTransformMarkdownCommand() *cobra.Command {
 		Short: "Transform mecab analysis json file to markdown",
 		Args:  cobra.NoArgs,
 		RunE: withLoggingE(func(cmd *cobra.Command, args []string) error {
-			return eachDate(dates, func(date time.Time) error {
-				return transformMarkdown(src, dest, date)
+			opts := markdownOptions{
+				topicFile:    topicFile,
+				reportFile:   reportFile,
+				period:       period,
+				thumbnails:   thumbnails,
+				snippets:     snippets,
+				format:       reportFormat,
+				templates:    templates,
+				templateName: templateName,
+			}
+			if !contains(reportFormats, reportFormat) {
+				return flagError{Message: "invalid format: %s", Args: []interface{}{reportFormat}}
+			}
+			if opts.reportFile == "" {
+				opts.reportFile = reportFileNames[reportFormat]
+			}
+			return eachPeriod(dates, period, func(date time.Time) error {
+				return transformMarkdown(src, dest, date, opts)
 			})
 		}),
 	}
@@ -100,6 +256,150 @@ func newTransformMarkdownCommand() *cobra.Command {
 	_ = cmd.MarkFlagRequired("date")
 	cmd.Flags().StringVar(&src, "src", "~/Desktop", "src dir path")
 	cmd.Flags().StringVar(&dest, "dest", "~/Desktop", "dest dir path")
+	cmd.Flags().StringVar(&topicFile, "topic", "topic.json", "input ranking file name")
+	cmd.Flags().StringVar(&reportFile, "report", "", "output report file name (default report.md or report.html)")
+	cmd.Flags().StringVar(&reportFormat, "format", "markdown",
+		fmt.Sprintf("report format (%s)", strings.Join(reportFormats, ", ")))
+	cmd.Flags().StringSliceVar(&templates, "template", nil, "report template files or directories (default built-in template)")
+	cmd.Flags().StringVar(&templateName, "template-name", "", "name of the template rendered as the report (default first template file name)")
+	setPeriodFlag(cmd.Flags(), &period)
+	cmd.Flags().BoolVar(&thumbnails, "thumbnails", false, "show article thumbnails")
+	cmd.Flags().BoolVar(&snippets, "snippets", false, "show article description snippets")
+
+	return cmd
+}
+
+func newRunPipelineCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "run",
+		Short: "Run yahoo, rss, json, analysis and markdown in order",
+		Args:  cobra.NoArgs,
+		RunE: withLoggingE(func(cmd *cobra.Command, args []string) error {
+			if !contains(tokenizerNames, tokenizerName) {
+				return flagError{Message: "invalid tokenizer: %s", Args: []interface{}{tokenizerName}}
+			}
+			var results []stageResult
+			err := eachDate(dates, func(date time.Time) error {
+				stages := pipelineStages(fetchDir, dest, date, fetch, tokenizerName)
+				results = append(results, runPipeline(stages, date, force)...)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			return printStageResults(results)
+		}),
+	}
+	cmd.PersistentFlags().StringVar(&fetchDir, "fetch", "~/Desktop", "fetch dir path")
+	cmd.PersistentFlags().StringVar(&dest, "dest", "~/Desktop", "dest dir path")
+	cmd.PersistentFlags().BoolVar(&force, "force", false, "run stages even if their outputs are up to date")
+	cmd.Flags().StringVar(&tokenizerName, "tokenizer", "mecab",
+		fmt.Sprintf("morphological analyzer used by the analysis stage (%s)", strings.Join(tokenizerNames, ", ")))
+	setFetchFlags(cmd.Flags(), &fetch)
+	setDatesFlag(cmd.Flags(), &dates, "target date")
+	_ = cmd.MarkFlagRequired("date")
+
+	return cmd
+}
+
+func newNormalizeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "normalize [title...]",
+		Short: "Show how title normalization rules change sample titles",
+		RunE: withLoggingE(func(cmd *cobra.Command, args []string) error {
+			n, err := newTitleNormalizer(titleRules)
+			if err != nil {
+				return err
+			}
+			if len(args) > 0 {
+				printNormalizeSteps(n, args)
+				return nil
+			}
+			return eachDate(dates, func(date time.Time) error {
+				titles, err := sampleTitles(src, date, samples)
+				if err != nil {
+					return err
+				}
+				printNormalizeSteps(n, titles)
+				return nil
+			})
+		}),
+	}
+	cmd.Flags().StringVar(&src, "src", "~/Desktop", "src dir path")
+	cmd.Flags().StringVar(&titleRules, "title-rules", "", "JSON file of title normalization rules (default built-in rules)")
+	cmd.Flags().IntVar(&samples, "samples", 20, "number of titles read from the article file of --date")
+	setDatesFlag(cmd.Flags(), &dates, "date of the article file used when no title is given")
+
+	return cmd
+}
+
+func newSiteCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "site",
+		Short: "Generate static site of all daily rankings",
+		Args:  cobra.NoArgs,
+		RunE: withLoggingE(func(cmd *cobra.Command, args []string) error {
+			return generateSite(src, dest, topicFile)
+		}),
+	}
+	cmd.Flags().StringVar(&src, "src", "~/Desktop", "src dir path")
+	cmd.Flags().StringVar(&dest, "dest", "~/Desktop", "dest dir path")
+	cmd.Flags().StringVar(&topicFile, "topic", "topic.json", "input ranking file name")
+
+	return cmd
+}
+
+func newFeedCommand() *cobra.Command {
+	opts := defaultFeedOptions()
+	cmd := &cobra.Command{
+		Use:   "feed",
+		Short: "Generate Atom, RSS and JSON feeds of daily rankings",
+		Args:  cobra.NoArgs,
+		RunE: withLoggingE(func(cmd *cobra.Command, args []string) error {
+			if !contains(feedModes, opts.mode) {
+				return flagError{Message: "invalid mode: %s", Args: []interface{}{opts.mode}}
+			}
+			return generateFeed(src, dest, opts)
+		}),
+	}
+	cmd.Flags().StringVar(&src, "src", "~/Desktop", "src dir path")
+	cmd.Flags().StringVar(&dest, "dest", "~/Desktop", "dest dir path")
+	cmd.Flags().StringVar(&opts.baseURL, "base-url", "", "URL of the site the feed entries link to (e.g. https://example.com/ranking/)")
+	_ = cmd.MarkFlagRequired("base-url")
+	cmd.Flags().StringVar(&opts.linkFormat, "link-format", opts.linkFormat, "path of the report of each day relative to --base-url, %s is replaced with YYYYMMDD")
+	cmd.Flags().StringVar(&opts.mode, "mode", opts.mode,
+		fmt.Sprintf("feed entry per (%s)", strings.Join(feedModes, ", ")))
+	cmd.Flags().StringVar(&opts.title, "title", opts.title, "feed title")
+	cmd.Flags().IntVar(&opts.days, "days", opts.days, "number of latest days in the feed (0 for all)")
+	cmd.Flags().IntVar(&opts.items, "items", opts.items, "maximum number of keywords in each daily entry")
+	cmd.Flags().StringVar(&opts.topicFile, "topic", opts.topicFile, "input ranking file name")
+	cmd.Flags().StringVar(&opts.trendingFile, "trending-file", opts.trendingFile, "input trending file name used by --mode trending")
+
+	return cmd
+}
+
+func newExportCommand() *cobra.Command {
+	opts := defaultExportOptions()
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export rankings and articles as CSV or TSV",
+		Args:  cobra.NoArgs,
+		RunE: withLoggingE(func(cmd *cobra.Command, args []string) error {
+			if !contains(exportFormats, opts.format) {
+				return flagError{Message: "invalid format: %s", Args: []interface{}{opts.format}}
+			}
+			return exportRankings(src, dest, dates, opts)
+		}),
+	}
+	cmd.Flags().StringVar(&src, "src", "~/Desktop", "src dir path")
+	cmd.Flags().StringVar(&dest, "dest", "~/Desktop", "dest dir path")
+	cmd.Flags().StringVar(&opts.format, "format", opts.format,
+		fmt.Sprintf("output format (%s)", strings.Join(exportFormats, ", ")))
+	cmd.Flags().StringVar(&opts.outFile, "out", "", "output file name (default ranking.csv or ranking.tsv)")
+	cmd.Flags().StringVar(&opts.topicFile, "topic", opts.topicFile, "input ranking file name")
+	cmd.Flags().BoolVar(&opts.bom, "bom", false, "prepend a UTF-8 byte order mark for spreadsheet applications")
+	setDatesFlag(cmd.Flags(), &dates, "target date")
+	_ = cmd.MarkFlagRequired("date")
 
 	return cmd
 }
@@ -110,8 +410,14 @@ func main() {
 		newFetchYahooNewsCommand(),
 		newFetchRSSCommand(),
 		newTransformJsonCommand(),
+		newFetchArticlesCommand(),
 		newTransformAnalysisCommand(),
 		newTransformMarkdownCommand(),
+		newRunPipelineCommand(),
+		newNormalizeCommand(),
+		newSiteCommand(),
+		newFeedCommand(),
+		newExportCommand(),
 	)
 
 	if err := rootCmd.Execute(); err != nil {
@@ -1,14 +1,12 @@
 package main
 
 import (
-	"encoding/json"
-	"io/ioutil"
-	"log"
+	"fmt"
 	"path/filepath"
-	"text/template"
 	"time"
 
 	"github.com/pkg/errors"
+	"go.uber.org/zap"
 )
 
 const tmplStr = `
@@ -16,24 +14,85 @@ const tmplStr = `
 title: "{{ .FormatDate }} に話題になったキーワードランキング"
 date: {{ .Date }}
 ---
+{{ if .Period }}
+集計日: {{ join .Days ", " }}
+{{ if .MissingDays }}
+記事ファイルがなく集計に含まれていない日: {{ join .MissingDays ", " }}
+{{ end }}
+{{ end }}
+{{ if .Trending -}}
+## 急上昇したキーワード
+
+{{ range $i, $item := .Trending -}}
+### {{ rank $i }}位 {{ $item.Word }} （{{ $item.Count }}{{ $.Unit }}、スコア {{ printf "%.2f" $item.Trend.Score }}）
+{{ range $j, $article := $item.Articles -}}
+{{ template "article" $article }}
+{{ end }}
+{{ end -}}
+## 多く言及されたキーワード
 
+{{ end -}}
 {{ range $i, $item := .Items -}}
-### {{ rank $i }}位 {{ $item.Word }} （{{ $item.Count }}記事）
+### {{ rank $i }}位 {{ $item.Word }} （{{ $item.Count }}{{ $.Unit }}{{ if $item.Score }}、TF-IDF {{ printf "%.2f" $item.Score.TFIDF }}{{ end }}）
 {{ range $j, $article := $item.Articles -}}
-- [{{ $article.Title }}]({{ $article.URL }})
+{{ template "article" $article }}
+{{ end }}
+{{ end }}
+{{- if .Stories }}
+## 複数の見出しで報じられたニュース
+
+{{ range $i, $story := .Stories -}}
+### {{ $story.Title }} （{{ len $story.Articles }}記事）
+{{ range $j, $article := $story.Articles -}}
+{{ template "article" $article }}
 {{ end }}
 {{ end }}
+{{- end }}
+{{- define "article" -}}
+- [{{ .Title }}]({{ .URL }})
+{{- with .Image }}
+  ![]({{ . }})
+{{- end }}
+{{- with .Snippet }}
+  {{ . }}
+{{- end }}
+{{- end }}
 `
 
-func transformMarkdown(src, dest string, date time.Time) (err error) {
-	srcPath := filepath.Join(src, date.Format("20060102"), "topic.json")
-	f, err := ioutil.ReadFile(srcPath)
-	if err != nil {
-		return err
+// markdownOptions はレポート生成の設定を表す
+type markdownOptions struct {
+	// topicFile は読み込むランキングのファイル名
+	topicFile string
+	// reportFile は出力するレポートのファイル名
+	reportFile string
+	// period は集計期間 (daily, weekly, monthly, quarterly, yearly)
+	period string
+	// thumbnails は記事のサムネイル画像を表示する場合に true
+	thumbnails bool
+	// snippets は記事の概要を表示する場合に true
+	snippets bool
+	// format はレポートの形式 (markdown, html)
+	format string
+	// templates はレポートのテンプレートファイルかディレクトリ。空の場合は組み込みのテンプレートを用いる
+	templates []string
+	// templateName はレポートとして出力するテンプレート名。空の場合は最初のテンプレートファイル名
+	templateName string
+}
+
+// defaultMarkdownOptions は topic.json から report.md を生成する設定を返す
+func defaultMarkdownOptions() markdownOptions {
+	return markdownOptions{
+		topicFile:  "topic.json",
+		reportFile: "report.md",
+		period:     "daily",
+		format:     "markdown",
 	}
+}
 
-	var c Content
-	if err = json.Unmarshal(f, &c); err != nil {
+func transformMarkdown(src, dest string, date time.Time, opts markdownOptions) (err error) {
+	dir := periodDir(opts.period, date)
+	c, err := readContent(filepath.Join(src, dir, opts.topicFile))
+	if err != nil {
 		return err
 	}
 
@@ -41,32 +100,86 @@ func transformMarkdown(src, dest string, date time.Time) (err error) {
 		return errors.New("content size is zero")
 	}
 
-	if err = writeContent(dest, date, c); err != nil {
+	t, ok, err := readTopicContent(src, dir, c.TrendingFile, opts.topicFile)
+	if err != nil {
 		return err
 	}
+	if ok {
+		c.Trending = t.Items
+	}
+	s, ok, err := readTopicContent(src, dir, c.StoriesFile, opts.topicFile)
+	if err != nil {
+		return err
+	}
+	if ok {
+		c.Stories = s.Stories
+	}
+	hideArticleDetails(&c, opts)
 
-	return nil
-}
-
-func writeContent(dest string, date time.Time, content Content) error {
-	f, err := createOutFile(filepath.Join(dest, date.Format("20060102"), "report.md"))
+	tmpl, err := parseReportTemplate(opts.format, builtinReportTemplates[opts.format], opts.templates, opts.templateName)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	return writeReport(filepath.Join(dest, dir, opts.reportFile), tmpl, newReportData(c))
+}
 
-	funcMap := template.FuncMap{
-		"rank": func(a int) int { return a + 1 },
+// hideArticleDetails は表示しない記事のサムネイル画像と概要を取り除く
+func hideArticleDetails(c *Content, opts markdownOptions) {
+	hide := func(articles []Article) {
+		for i := range articles {
+			if !opts.thumbnails {
+				articles[i].Image = ""
+			}
+			if !opts.snippets {
+				articles[i].Snippet = ""
+			}
+		}
+	}
+	groups := [][]ContentItem{c.Items, c.Trending}
+	for _, category := range c.Categories {
+		groups = append(groups, category.Items)
 	}
-	t := template.Must(template.New("funcmap").Funcs(funcMap).Parse(tmplStr))
+	for _, items := range groups {
+		for _, item := range items {
+			hide(item.Articles)
+		}
+	}
+	for _, s := range c.Stories {
+		hide(s.Articles)
+	}
+}
 
-	// Execute(io.Writer(出力先), データ)
-	if err := t.Execute(f, content); err != nil {
-		log.Fatal(err)
+// readTopicContent はランキングと同時に出力した急上昇キーワードなどのファイルを読み込む
+// 別の実行で上書きされて topicFile のランキングと対応しなくなったファイルは読み込まない
+func readTopicContent(src, dir, fileName, topicFile string) (Content, bool, error) {
+	c, ok, err := readOptionalContent(src, dir, fileName)
+	if err != nil || !ok {
+		if err == nil && fileName != "" {
+			// ランキングだけでもレポートは生成するので warnnig log を出力する
+			fmt.Println("file not found.", zap.String("path", filepath.Join(src, dir, fileName)))
+		}
+		return Content{}, false, err
+	}
+	if c.TopicFile != topicFile {
+		fmt.Println("skipped file written with another ranking.", zap.String("path", filepath.Join(src, dir, fileName)), zap.String("topic", c.TopicFile))
+		return Content{}, false, nil
 	}
+	return c, true, nil
+}
 
-	if err := f.Sync(); err != nil {
-		return errors.Wrap(err, "failed to sync file")
+// readOptionalContent はファイル名が空でなくファイルが存在する場合だけ読み込む
+func readOptionalContent(src, dir, fileName string) (Content, bool, error) {
+	if fileName == "" {
+		return Content{}, false, nil
+	}
+	path := filepath.Join(src, dir, fileName)
+	ok, err := exists(path)
+	if err != nil || !ok {
+		return Content{}, false, err
+	}
+	c, err := readContent(path)
+	if err != nil {
+		return Content{}, false, err
 	}
-	return nil
+	return c, true, nil
 }
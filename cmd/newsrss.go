@@ -1,60 +1,183 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"time"
 
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
-func fetchYahooNewsRSS(src, dest string, maxRetry uint) error {
+// feedStateFile は条件付きリクエストのためにRSSごとのレスポンスヘッダを保存するファイル名
+const feedStateFile = "state.json"
+
+// snapshotLayout はRSSのスナップショットのファイル名に用いる取得時刻のフォーマット
+const snapshotLayout = "150405"
+
+// feedState はRSSを前回取得したときのレスポンスヘッダを表す
+type feedState struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// fetchResult はRSSの取得結果を表す
+type fetchResult struct {
+	state feedState
+	// unchanged は前回取得してから更新されていない (304 Not Modified) 場合に true
+	unchanged bool
+	err       error
+}
+
+// fetchYahooNewsRSS は rss.jsonl に記載された全てのRSSを並列に取得する
+// RSSは取得するたびに dest/YYYYMMDD/<RSSのID>/HHMMSS.xml にスナップショットとして保存する
+// 同じ日に取得済みのRSSは ETag/Last-Modified による条件付きリクエストで取得し、更新がなければスキップする
+// 取得に失敗したRSSがあっても処理は止めずに、最後に取得結果をまとめて出力する
+func fetchYahooNewsRSS(src, dest string, opts fetchOptions) error {
 	feeds, err := readYahooRSSFeed(filepath.Join(src, "rss.jsonl"))
 	if err != nil {
 		return errors.WithMessage(err, "failed to read rss.json")
 	}
 
-	destDir := filepath.Join(dest, time.Now().Format("20060102"))
-	for _, feed := range feeds {
-		err = request(destDir, feed, maxRetry)
-		if err != nil {
-			fmt.Println("failed to fetch RSS", zap.String("url", feed.URL), zap.Error(err))
-			continue
+	now := time.Now()
+	destDir := filepath.Join(dest, now.Format("20060102"))
+	statePath := filepath.Join(destDir, feedStateFile)
+	states, err := readFeedStates(statePath)
+	if err != nil {
+		return err
+	}
+
+	f := newFetcher(opts)
+	results := make([]fetchResult, len(feeds))
+	parallel(len(feeds), opts.concurrency, func(i int) {
+		results[i] = request(f, destDir, feeds[i], states[feeds[i].ID], now)
+	})
+
+	var fetched, unchanged, failed int
+	for i, r := range results {
+		switch {
+		case r.err != nil:
+			failed++
+			fmt.Println("failed to fetch RSS", zap.String("url", feeds[i].URL), zap.Error(r.err))
+		case r.unchanged:
+			unchanged++
+			fmt.Println("skipped unchanged RSS", zap.String("url", feeds[i].URL))
+		default:
+			fetched++
+			states[feeds[i].ID] = r.state
 		}
 	}
-	return nil
+	fmt.Printf("fetched %d feeds, %d unchanged, %d failed\n", fetched, unchanged, failed)
+
+	if fetched == 0 {
+		return nil
+	}
+	return writeFeedStates(statePath, states)
 }
 
-func request(out string, feed YahooRSSFeed, maxRetry uint) (err error) {
-	var res *http.Response
-	retry := uint(0)
-	for {
-		res, err = http.Get(feed.URL)
-		retry++
-		if err == nil || retry > maxRetry {
-			break
-		}
-		time.Sleep(3 * time.Second)
+func request(f *fetcher, out string, feed YahooRSSFeed, state feedState, now time.Time) fetchResult {
+	req, err := http.NewRequest(http.MethodGet, feed.URL, nil)
+	if err != nil {
+		return fetchResult{err: errors.Wrapf(err, "invalid url : %s", feed.URL)}
 	}
+	snapshots, err := feedSnapshots(out, feed)
 	if err != nil {
-		return errors.Wrapf(err, "failed request url : %s", feed.URL)
+		return fetchResult{err: err}
+	}
+	if len(snapshots) > 0 {
+		// 取得済みのファイルがある場合だけ条件付きリクエストにする
+		if state.ETag != "" {
+			req.Header.Set("If-None-Match", state.ETag)
+		}
+		if state.LastModified != "" {
+			req.Header.Set("If-Modified-Since", state.LastModified)
+		}
 	}
 
+	res, err := f.do(req)
+	if err != nil {
+		return fetchResult{err: err}
+	}
 	defer res.Body.Close()
 
+	if res.StatusCode == http.StatusNotModified {
+		return fetchResult{state: state, unchanged: true}
+	}
 	if res.StatusCode != http.StatusOK {
-		return errors.Errorf("status code expected 200 but was %d : url=%s", res.StatusCode, feed.URL)
+		return fetchResult{err: errors.Errorf("status code expected 200 but was %d : url=%s", res.StatusCode, feed.URL)}
 	}
 
-	filePath := filepath.Join(out, feed.ID)
+	filePath := filepath.Join(out, feed.ID, now.Format(snapshotLayout)+".xml")
 	if err = save(res, filePath); err != nil {
+		return fetchResult{err: err}
+	}
+
+	return fetchResult{
+		state: feedState{
+			ETag:         res.Header.Get("ETag"),
+			LastModified: res.Header.Get("Last-Modified"),
+		},
+	}
+}
+
+// feedSnapshots は日付ディレクトリに保存したRSSのスナップショットを取得時刻順に返す
+// スナップショットに分ける前の dayDir/<RSSのID> に保存したファイルもスナップショットとして扱う
+func feedSnapshots(dayDir string, feed YahooRSSFeed) ([]string, error) {
+	path := filepath.Join(dayDir, feed.ID)
+	stat, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to stat: %s", path)
+	}
+	if !stat.IsDir() {
+		return []string{path}, nil
+	}
+	snapshots, err := filepath.Glob(filepath.Join(path, "*.xml"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list snapshots: %s", path)
+	}
+	// ファイル名が取得時刻なので名前順が取得時刻順となる
+	sort.Strings(snapshots)
+	return snapshots, nil
+}
+
+// readFeedStates はRSSのIDごとのレスポンスヘッダを読み込む。ファイルがない場合は空で返す
+func readFeedStates(path string) (map[string]feedState, error) {
+	states := make(map[string]feedState)
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read file: %s", path)
+	}
+	if err := json.Unmarshal(b, &states); err != nil {
+		return nil, errors.Wrapf(err, "could not unmarshal: %s", path)
+	}
+	return states, nil
+}
+
+func writeFeedStates(path string, states map[string]feedState) error {
+	f, err := createOutFile(path)
+	if err != nil {
 		return err
 	}
+	defer f.Close()
 
+	if err := appendOutFile(f, states); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return errors.Wrap(err, "failed to sync file")
+	}
 	return nil
 }
 
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testRSS = `<?xml version="1.0" encoding="UTF-8"?><rss version="2.0"><channel><title>test</title></channel></rss>`
+
+// testFeedServer は news.yahoo.co.jp の代わりにRSSを返すサーバー
+// /ok/ 以下は RSS を、/fail は 500 を返し、/slow はクライアントが切断するまで応答しない
+// /delay/ 以下は testFeedDelay 待ってから RSS を返す
+// /etag は If-None-Match が一致する場合に 304 を返す
+type testFeedServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	arrivals []time.Time
+	// notModified は 304 を返した回数
+	notModified int
+	// inFlight は処理中のリクエスト数で、peak はその最大値
+	inFlight, peak int
+}
+
+// testFeedDelay は /delay/ 以下のRSSが応答するまでの時間
+const testFeedDelay = 200 * time.Millisecond
+
+func newTestFeedServer(t *testing.T) *testFeedServer {
+	t.Helper()
+	s := &testFeedServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, testRSS)
+	})
+	mux.HandleFunc("/delay/", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(testFeedDelay)
+		fmt.Fprint(w, testRSS)
+	})
+	mux.HandleFunc("/fail", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	mux.HandleFunc("/etag", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			s.mu.Lock()
+			s.notModified++
+			s.mu.Unlock()
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, testRSS)
+	})
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.arrivals = append(s.arrivals, time.Now())
+		s.inFlight++
+		if s.inFlight > s.peak {
+			s.peak = s.inFlight
+		}
+		s.mu.Unlock()
+		defer func() {
+			s.mu.Lock()
+			s.inFlight--
+			s.mu.Unlock()
+		}()
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// writeTestFeeds は src/rss.jsonl にサーバーのパスを URL とするRSSの一覧を書き込む
+func writeTestFeeds(t *testing.T, src string, s *testFeedServer, paths map[string]string) {
+	t.Helper()
+	f, err := createOutFile(filepath.Join(src, "rss.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	ids := make([]string, 0, len(paths))
+	for id := range paths {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if err := appendOutFile(f, YahooRSSFeed{ID: id, Name: id, URL: s.URL + paths[id]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func testFetchOptions() fetchOptions {
+	opts := defaultFetchOptions()
+	opts.maxRetry = 0
+	opts.retryWait = 0
+	opts.concurrency = 3
+	opts.interval = 0
+	opts.timeout = 300 * time.Millisecond
+	return opts
+}
+
+func TestFetchYahooNewsRSS(t *testing.T) {
+	s := newTestFeedServer(t)
+	dir := t.TempDir()
+	writeTestFeeds(t, dir, s, map[string]string{
+		"ok1":  "/ok/1",
+		"ok2":  "/ok/2",
+		"ok3":  "/ok/3",
+		"ok4":  "/ok/4",
+		"fail": "/fail",
+		"slow": "/slow",
+	})
+
+	if err := fetchYahooNewsRSS(dir, dir, testFetchOptions()); err != nil {
+		t.Fatal(err)
+	}
+
+	dayDir := filepath.Join(dir, time.Now().Format("20060102"))
+	for _, id := range []string{"ok1", "ok2", "ok3", "ok4"} {
+		snapshots, err := feedSnapshots(dayDir, YahooRSSFeed{ID: id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(snapshots) != 1 {
+			t.Errorf("%s has %d snapshots, want 1", id, len(snapshots))
+			continue
+		}
+		b, err := ioutil.ReadFile(snapshots[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != testRSS {
+			t.Errorf("%s saved %q, want %q", id, b, testRSS)
+		}
+	}
+	for _, id := range []string{"fail", "slow"} {
+		if _, err := os.Stat(filepath.Join(dayDir, id)); !os.IsNotExist(err) {
+			t.Errorf("%s should not be saved: %v", id, err)
+		}
+	}
+}
+
+func TestFetchYahooNewsRSSConcurrency(t *testing.T) {
+	s := newTestFeedServer(t)
+	dir := t.TempDir()
+	const feeds = 9
+	paths := make(map[string]string)
+	for i := 1; i <= feeds; i++ {
+		paths[fmt.Sprintf("delay%d", i)] = fmt.Sprintf("/delay/%d", i)
+	}
+	// 応答しないRSSを最初に取得させ、タイムアウトまでの間も他のRSSを並列に取得することを確かめる
+	paths["a-slow"] = "/slow"
+	writeTestFeeds(t, dir, s, paths)
+
+	opts := testFetchOptions()
+	opts.concurrency = 3
+	opts.timeout = time.Second
+	start := time.Now()
+	if err := fetchYahooNewsRSS(dir, dir, opts); err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+
+	// 順に取得すると応答待ちの合計 (9*200ms + 1s) かかるが、3並列なら応答しないRSSのタイムアウトの間に
+	// 残りの2並列で他のRSSを取得して 1s 程度で終わる
+	sequential := feeds*testFeedDelay + opts.timeout
+	if elapsed > sequential/2 {
+		t.Errorf("fetching took %v, want well below %v of sequential requests", elapsed, sequential)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.peak > opts.concurrency {
+		t.Errorf("%d requests were in flight at once, want at most %d", s.peak, opts.concurrency)
+	}
+	if s.peak < 2 {
+		t.Errorf("at most %d request was in flight, want requests in parallel", s.peak)
+	}
+
+	dayDir := filepath.Join(dir, time.Now().Format("20060102"))
+	for i := 1; i <= feeds; i++ {
+		id := fmt.Sprintf("delay%d", i)
+		snapshots, err := feedSnapshots(dayDir, YahooRSSFeed{ID: id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(snapshots) != 1 {
+			t.Errorf("%s has %d snapshots, want 1", id, len(snapshots))
+		}
+	}
+}
+
+func TestFetchYahooNewsRSSNotModified(t *testing.T) {
+	s := newTestFeedServer(t)
+	dir := t.TempDir()
+	writeTestFeeds(t, dir, s, map[string]string{"etag": "/etag"})
+
+	for i := 0; i < 2; i++ {
+		if err := fetchYahooNewsRSS(dir, dir, testFetchOptions()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dayDir := filepath.Join(dir, time.Now().Format("20060102"))
+	states, err := readFeedStates(filepath.Join(dayDir, feedStateFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := states["etag"].ETag; got != `"v1"` {
+		t.Errorf("saved etag = %q, want %q", got, `"v1"`)
+	}
+	snapshots, err := feedSnapshots(dayDir, YahooRSSFeed{ID: "etag"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 {
+		t.Errorf("got %d snapshots, want 1 because the second response was 304", len(snapshots))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.notModified != 1 {
+		t.Errorf("server returned 304 %d times, want 1", s.notModified)
+	}
+}
+
+func TestFetchYahooNewsRSSInterval(t *testing.T) {
+	s := newTestFeedServer(t)
+	dir := t.TempDir()
+	paths := make(map[string]string)
+	for i := 1; i <= 4; i++ {
+		paths[fmt.Sprintf("ok%d", i)] = fmt.Sprintf("/ok/%d", i)
+	}
+	writeTestFeeds(t, dir, s, paths)
+
+	opts := testFetchOptions()
+	opts.concurrency = 4
+	opts.interval = 100 * time.Millisecond
+	start := time.Now()
+	if err := fetchYahooNewsRSS(dir, dir, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.arrivals) != len(paths) {
+		t.Fatalf("server received %d requests, want %d", len(s.arrivals), len(paths))
+	}
+	assertSpaced(t, s.URL, start, s.arrivals, opts.interval)
+}
+
+// assertSpaced は同じホストへの k 番目のリクエストが start から k*interval 以上経過していることを確かめる
+// goroutine の起床の遅れで隣り合うリクエストの間隔は interval より短くなりうるので、開始時刻からの経過で比べる
+func assertSpaced(t *testing.T, host string, start time.Time, times []time.Time, interval time.Duration) {
+	t.Helper()
+	sorted := append([]time.Time(nil), times...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Before(sorted[j]) })
+	for k, at := range sorted {
+		if want := time.Duration(k) * interval; at.Sub(start) < want {
+			t.Errorf("%s: request #%d was sent %v after start, want at least %v", host, k+1, at.Sub(start), want)
+		}
+	}
+}
+
+func TestHostLimiter(t *testing.T) {
+	const interval = 50 * time.Millisecond
+	l := newHostLimiter(interval)
+	a, _ := url.Parse("http://a.example.com/rss")
+	b, _ := url.Parse("http://b.example.com/rss")
+
+	var mu sync.Mutex
+	times := make(map[string][]time.Time)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		for _, u := range []*url.URL{a, b} {
+			wg.Add(1)
+			go func(u *url.URL) {
+				defer wg.Done()
+				l.wait(u)
+				mu.Lock()
+				times[u.Host] = append(times[u.Host], time.Now())
+				mu.Unlock()
+			}(u)
+		}
+	}
+	wg.Wait()
+
+	for host, ts := range times {
+		assertSpaced(t, host, start, ts, interval)
+	}
+	// 別のホストへのリクエストは待たされないので、4件ずつなら1ホスト分の時間で終わる
+	if elapsed := time.Since(start); elapsed > 6*interval {
+		t.Errorf("took %v, requests to different hosts should not wait for each other", elapsed)
+	}
+}
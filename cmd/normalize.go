@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/unicode/norm"
+)
+
+// titleRule はタイトルの正規化ルールを表す
+//
+// Type には以下を指定する
+//   - trim: 前後の空白を取り除く
+//   - lower: 小文字に変換する
+//   - nfkc: NFKC正規化する (全角英数字や半角カナを揃える)
+//   - replace: Pattern の文字列を Replace に置き換える
+//   - regexp: 正規表現 Pattern にマッチした部分を Replace に置き換える
+//   - bracket: Open と Close で囲まれた部分を Mode に従って取り除く
+//   - keep: 正規表現 Pattern にマッチしないタイトルを集計から除く
+//   - drop: 正規表現 Pattern にマッチするタイトルを集計から除く
+type titleRule struct {
+	Type    string `json:"type"`
+	Pattern string `json:"pattern,omitempty"`
+	Replace string `json:"replace,omitempty"`
+	Open    string `json:"open,omitempty"`
+	Close   string `json:"close,omitempty"`
+	// Mode は bracket の取り除き方
+	//   - cut-last: 最後の Open から後ろを取り除く
+	//   - cut-first: 最初の Close までを取り除く
+	//   - leading: 先頭の括弧書きを取り除く
+	//   - trailing: 末尾の括弧書きを取り除く
+	//   - all: 全ての括弧書きを取り除く
+	//   - unwrap: 括弧だけを取り除いて中身は残す
+	Mode string `json:"mode,omitempty"`
+}
+
+// defaultTitleRules はルールファイルを指定しなかった場合の正規化ルール
+// 末尾のメディア名などの括弧書きを取り除く
+var defaultTitleRules = []titleRule{
+	{Type: "trim"},
+	{Type: "lower"},
+	{Type: "bracket", Open: "(", Mode: "cut-last"},
+	{Type: "bracket", Open: "（", Mode: "cut-last"},
+	{Type: "bracket", Open: "[", Mode: "cut-last"},
+	{Type: "bracket", Open: "〈", Mode: "cut-last"},
+	{Type: "bracket", Open: "【", Close: "】", Mode: "trailing"},
+	{Type: "bracket", Open: "【", Close: "】", Mode: "unwrap"},
+	{Type: "bracket", Close: "]", Mode: "cut-first"},
+	{Type: "replace", Pattern: ":"},
+	{Type: "replace", Pattern: "にも"},
+}
+
+// titleNormalizer は正規化ルールを順に適用してタイトルを正規化する
+type titleNormalizer struct {
+	rules []compiledTitleRule
+}
+
+type compiledTitleRule struct {
+	titleRule
+	re *regexp.Regexp
+}
+
+// newTitleNormalizer は正規化ルールのJSONファイルを読み込む。path が空の場合は defaultTitleRules を用いる
+func newTitleNormalizer(path string) (*titleNormalizer, error) {
+	rules := defaultTitleRules
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read title rule file: %s", path)
+		}
+		if err := json.Unmarshal(b, &rules); err != nil {
+			return nil, errors.Wrapf(err, "could not unmarshal: %s", path)
+		}
+	}
+	return compileTitleRules(rules)
+}
+
+func compileTitleRules(rules []titleRule) (*titleNormalizer, error) {
+	n := &titleNormalizer{}
+	for i, r := range rules {
+		c := compiledTitleRule{titleRule: r}
+		switch r.Type {
+		case "trim", "lower", "nfkc", "replace":
+		case "regexp", "keep", "drop":
+			re, err := regexp.Compile(r.Pattern)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid pattern in title rule #%d", i+1)
+			}
+			c.re = re
+		case "bracket":
+			switch r.Mode {
+			case "cut-last", "cut-first", "leading", "trailing", "all", "unwrap":
+			default:
+				return nil, errors.Errorf("invalid bracket mode in title rule #%d: %s", i+1, r.Mode)
+			}
+			// 空の括弧は全ての位置に一致して、all では無限ループになり unwrap では文字の間に空白が入る
+			if r.Open == "" && r.Mode != "cut-first" {
+				return nil, errors.Errorf("open is required for bracket mode %s in title rule #%d", r.Mode, i+1)
+			}
+			if r.Close == "" && r.Mode != "cut-last" {
+				return nil, errors.Errorf("close is required for bracket mode %s in title rule #%d", r.Mode, i+1)
+			}
+		default:
+			return nil, errors.Errorf("invalid title rule type #%d: %s", i+1, r.Type)
+		}
+		n.rules = append(n.rules, c)
+	}
+	return n, nil
+}
+
+// normalize はタイトルを正規化する。集計から除くタイトルの場合は false を返す
+func (n *titleNormalizer) normalize(title string) (string, bool) {
+	for _, r := range n.rules {
+		var ok bool
+		title, ok = r.apply(title)
+		if !ok {
+			return "", false
+		}
+	}
+	return title, true
+}
+
+// steps はルールごとの適用結果を返す。集計から除かれた場合はその時点で打ち切って false を返す
+func (n *titleNormalizer) steps(title string) ([]string, bool) {
+	var ret []string
+	for _, r := range n.rules {
+		var ok bool
+		title, ok = r.apply(title)
+		if !ok {
+			return ret, false
+		}
+		ret = append(ret, title)
+	}
+	return ret, true
+}
+
+func (r compiledTitleRule) apply(title string) (string, bool) {
+	switch r.Type {
+	case "trim":
+		return strings.TrimSpace(title), true
+	case "lower":
+		return strings.ToLower(title), true
+	case "nfkc":
+		return norm.NFKC.String(title), true
+	case "replace":
+		return strings.ReplaceAll(title, r.Pattern, r.Replace), true
+	case "regexp":
+		return r.re.ReplaceAllString(title, r.Replace), true
+	case "keep":
+		return title, r.re.MatchString(title)
+	case "drop":
+		return title, !r.re.MatchString(title)
+	case "bracket":
+		return r.stripBracket(title), true
+	}
+	return title, true
+}
+
+func (r compiledTitleRule) stripBracket(title string) string {
+	switch r.Mode {
+	case "cut-last":
+		if i := strings.LastIndex(title, r.Open); i >= 0 {
+			return title[:i]
+		}
+	case "cut-first":
+		if i := strings.Index(title, r.Close); i >= 0 {
+			return title[i+len(r.Close):]
+		}
+	case "leading":
+		if strings.HasPrefix(title, r.Open) {
+			if i := strings.Index(title, r.Close); i >= 0 {
+				return title[i+len(r.Close):]
+			}
+		}
+	case "trailing":
+		if strings.HasSuffix(title, r.Close) {
+			if i := strings.LastIndex(title, r.Open); i >= 0 {
+				return title[:i]
+			}
+		}
+	case "all":
+		for {
+			i := strings.Index(title, r.Open)
+			if i < 0 {
+				break
+			}
+			j := strings.Index(title[i+len(r.Open):], r.Close)
+			if j < 0 {
+				break
+			}
+			title = title[:i] + title[i+len(r.Open)+j+len(r.Close):]
+		}
+	case "unwrap":
+		title = strings.ReplaceAll(title, r.Open, " ")
+		title = strings.ReplaceAll(title, r.Close, " ")
+	}
+	return title
+}
+
+// describe はルールを1行で表す
+func (r titleRule) describe() string {
+	switch r.Type {
+	case "replace", "regexp":
+		return fmt.Sprintf("%s %q -> %q", r.Type, r.Pattern, r.Replace)
+	case "keep", "drop":
+		return fmt.Sprintf("%s %q", r.Type, r.Pattern)
+	case "bracket":
+		return fmt.Sprintf("bracket %s %q %q", r.Mode, r.Open, r.Close)
+	}
+	return r.Type
+}
+
+// printNormalizeSteps はタイトルごとに各ルールの適用結果を出力する
+// ルールを適用しても変化しなかった場合は出力しない
+func printNormalizeSteps(n *titleNormalizer, titles []string) {
+	for _, title := range titles {
+		fmt.Printf("%s\n", title)
+		results, ok := n.steps(title)
+		prev := title
+		for i, result := range results {
+			if result != prev {
+				fmt.Printf("  #%d %s: %s\n", i+1, n.rules[i].describe(), result)
+			}
+			prev = result
+		}
+		if !ok {
+			fmt.Printf("  #%d %s: dropped\n", len(results)+1, n.rules[len(results)].describe())
+			continue
+		}
+		fmt.Printf("  => %s\n", prev)
+	}
+}
+
+// sampleTitles は date の記事ファイルから先頭 n 件のタイトルを返す
+func sampleTitles(src string, date time.Time, n int) ([]string, error) {
+	articles, err := readArticles(filepath.Join(src, date.Format("20060102"), "rss.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	var titles []string
+	for _, a := range articles {
+		if len(titles) >= n {
+			break
+		}
+		titles = append(titles, a.Title)
+	}
+	return titles, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// compoundNouns は名詞が連続する箇所を連結して複合名詞として返す
+// 連続する名詞が2以上の場合に返し、max より長い場合は max 個ずつずらして連結したものを返す
+// max が1以下の場合は何も返さない
+func compoundNouns(tokens []Token, max int) []string {
+	if max < 2 {
+		return nil
+	}
+	var ret []string
+	var run []string
+	flush := func() {
+		n := len(run)
+		if n > max {
+			n = max
+		}
+		for i := 0; n >= 2 && i+n <= len(run); i++ {
+			ret = append(ret, strings.Join(run[i:i+n], ""))
+		}
+		run = run[:0]
+	}
+	for _, t := range tokens {
+		if isNoun(t) {
+			run = append(run, t.Surface)
+			continue
+		}
+		flush()
+	}
+	flush()
+	return ret
+}
+
+// tokenNGrams は形態素の n-gram を返す。n が1以下の場合は何も返さない
+// 記号と空白は n-gram の区切りとして扱い、記号をまたいだ n-gram は返さない
+func tokenNGrams(tokens []Token, n int) []string {
+	if n < 2 {
+		return nil
+	}
+	var ret []string
+	var run []string
+	for _, t := range tokens {
+		if isBoundary(t) {
+			run = run[:0]
+			continue
+		}
+		run = append(run, t.Surface)
+		if len(run) >= n {
+			ret = append(ret, strings.Join(run[len(run)-n:], ""))
+		}
+	}
+	return ret
+}
+
+// isBoundary は n-gram の区切りとなる記号や空白の場合に true を返す
+// IPA 辞書で名詞,サ変接続となる ASCII の記号も区切りとする
+func isBoundary(t Token) bool {
+	if len(t.Features) > 0 && t.Features[0] == "記号" {
+		return true
+	}
+	return strings.TrimSpace(t.Surface) == "" || isSymbol(t.Surface)
+}
+
+// isNoun は複合名詞の構成要素となる名詞の場合に true を返す
+// 「こと」などの非自立の名詞や、IPA 辞書で名詞,サ変接続となる ASCII の記号は複合名詞に含めない
+func isNoun(t Token) bool {
+	if len(t.Features) < 2 || t.Features[0] != "名詞" {
+		return false
+	}
+	if isSymbol(t.Surface) {
+		return false
+	}
+	return t.Features[1] != "非自立" && t.Features[1] != "代名詞"
+}
+
+// isSymbol は全ての文字が句読点か記号の場合に true を返す
+func isSymbol(s string) bool {
+	for _, r := range s {
+		if !unicode.IsPunct(r) && !unicode.IsSymbol(r) {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func tokenizeTest(t *testing.T, s string) []Token {
+	t.Helper()
+	tokenizer, err := newKagomeTokenizer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tokenizer.Close()
+	tokens, err := tokenizer.Tokenize(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokens
+}
+
+func TestTokenNGrams(t *testing.T) {
+	tests := []struct {
+		title string
+		n     int
+		// want は含まれるべき n-gram
+		want []string
+		// notWant は記号や空白をまたぐため含まれてはいけない n-gram
+		notWant []string
+	}{
+		{
+			title:   `【速報】東京で大雨,"感染拡大 新たに"`,
+			n:       2,
+			want:    []string{"東京で", "で大雨", "感染拡大"},
+			notWant: []string{"速報東京", "大雨感染", "拡大新た"},
+		},
+		{
+			title: `大雨,"警報"`,
+			n:     2,
+		},
+		{
+			title: "東京で大雨",
+			n:     1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			grams := tokenNGrams(tokenizeTest(t, tt.title), tt.n)
+			got := make(map[string]bool, len(grams))
+			for _, g := range grams {
+				got[g] = true
+				if strings.ContainsAny(g, "【】,\" ") {
+					t.Errorf("n-gram %q contains a symbol or space", g)
+				}
+			}
+			for _, w := range tt.want {
+				if !got[w] {
+					t.Errorf("%q not found in %q", w, grams)
+				}
+			}
+			for _, w := range tt.notWant {
+				if got[w] {
+					t.Errorf("%q spans a symbol or space: %q", w, grams)
+				}
+			}
+			if tt.n < 2 && len(grams) > 0 {
+				t.Errorf("got %q, want no n-grams", grams)
+			}
+		})
+	}
+}
+
+func TestCompoundNouns(t *testing.T) {
+	tests := []struct {
+		title string
+		max   int
+		want  []string
+	}{
+		{title: "日米首脳会談", max: 4, want: []string{"日米首脳会談"}},
+		{title: "日米首脳会談", max: 3, want: []string{"日米首脳", "米首脳会談"}},
+		{title: `"会見"で説明`, max: 4, want: nil},
+	}
+	for _, tt := range tests {
+		got := compoundNouns(tokenizeTest(t, tt.title), tt.max)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("compoundNouns(%q, %d) = %q, want %q", tt.title, tt.max, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+)
+
+// stage はパイプラインの1工程を表す
+type stage struct {
+	name    string
+	inputs  []string
+	outputs []string
+	// upToDate が nil の場合は inputs と outputs の更新日時を比較する
+	upToDate func() (bool, error)
+	run      func() error
+}
+
+// stageStatus は工程の実行結果を表す
+type stageStatus string
+
+const (
+	stageDone    stageStatus = "done"
+	stageSkipped stageStatus = "skipped"
+	stageFailed  stageStatus = "failed"
+)
+
+// stageResult は日付ごとの工程の実行結果を表す
+type stageResult struct {
+	date   time.Time
+	name   string
+	status stageStatus
+	reason string
+	err    error
+}
+
+// pipelineStages は yahoo → rss → json → analysis → markdown の各工程を対象日付について組み立てる
+// tokenizer は analysis の工程で使う形態素解析器の名前
+func pipelineStages(fetchDir, dest string, date time.Time, fetch fetchOptions, tokenizer string) []stage {
+	dateStr := date.Format("20060102")
+	feedList := filepath.Join(fetchDir, "rss.jsonl")
+	feedDir := filepath.Join(fetchDir, dateStr)
+	articles := filepath.Join(dest, dateStr, "rss.jsonl")
+	topic := filepath.Join(dest, dateStr, "topic.json")
+	report := filepath.Join(dest, dateStr, "report.md")
+
+	return []stage{
+		{
+			name:    "yahoo",
+			outputs: []string{feedList},
+			run: func() error {
+				return fetchYahooNewsRSSList(fetchDir, fetch.maxRetry)
+			},
+		},
+		{
+			name:    "rss",
+			inputs:  []string{feedList},
+			outputs: []string{feedDir},
+			upToDate: func() (bool, error) {
+				// RSSは取得した時点の内容なので、当日分は常に取得し直す
+				if isToday(date) {
+					return false, nil
+				}
+				return exists(feedDir)
+			},
+			run: func() error {
+				if !isToday(date) {
+					return errors.Errorf("rss feeds can only be fetched for today: %s", dateStr)
+				}
+				return fetchYahooNewsRSS(fetchDir, fetchDir, fetch)
+			},
+		},
+		{
+			name:    "json",
+			inputs:  []string{feedList, feedDir},
+			outputs: []string{articles},
+			run: func() error {
+				return transformJSON(fetchDir, dest, date)
+			},
+		},
+		{
+			name:    "analysis",
+			inputs:  []string{articles},
+			outputs: []string{topic},
+			run: func() error {
+				opts := defaultAnalysisOptions()
+				opts.tokenizer = tokenizer
+				return transformAnalysis(dest, dest, date, opts)
+			},
+		},
+		{
+			name:    "markdown",
+			inputs:  []string{topic},
+			outputs: []string{report},
+			run: func() error {
+				return transformMarkdown(dest, dest, date, defaultMarkdownOptions())
+			},
+		},
+	}
+}
+
+// runPipeline は対象日付ごとに全工程を順に実行して、工程ごとの実行結果を返す
+// 工程が失敗した場合、その日付の後続の工程はスキップする
+func runPipeline(stages []stage, date time.Time, force bool) []stageResult {
+	var results []stageResult
+	var failed string
+	for _, s := range stages {
+		r := stageResult{date: date, name: s.name}
+		if failed != "" {
+			r.status = stageSkipped
+			r.reason = fmt.Sprintf("%s failed", failed)
+			results = append(results, r)
+			continue
+		}
+		if !force {
+			ok, err := s.isUpToDate()
+			if err != nil {
+				r.status = stageFailed
+				r.err = err
+				failed = s.name
+				results = append(results, r)
+				continue
+			}
+			if ok {
+				r.status = stageSkipped
+				r.reason = "up to date"
+				results = append(results, r)
+				continue
+			}
+		}
+		if err := s.run(); err != nil {
+			r.status = stageFailed
+			r.err = err
+			failed = s.name
+		} else {
+			r.status = stageDone
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+func (s stage) isUpToDate() (bool, error) {
+	if s.upToDate != nil {
+		return s.upToDate()
+	}
+	return outputsUpToDate(s.inputs, s.outputs)
+}
+
+// outputsUpToDate は全ての出力が存在し、全ての入力より新しい場合に true を返す
+func outputsUpToDate(inputs, outputs []string) (bool, error) {
+	var oldestOutput time.Time
+	for i, path := range outputs {
+		stat, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to stat: %s", path)
+		}
+		if i == 0 || stat.ModTime().Before(oldestOutput) {
+			oldestOutput = stat.ModTime()
+		}
+	}
+	for _, path := range inputs {
+		latest, err := latestModTime(path)
+		if err != nil {
+			return false, err
+		}
+		if latest.After(oldestOutput) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// latestModTime はファイル、またはディレクトリ配下で最も新しい更新日時を返す
+func latestModTime(path string) (time.Time, error) {
+	var latest time.Time
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "failed to walk: %s", path)
+	}
+	return latest, nil
+}
+
+func exists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to stat: %s", path)
+	}
+	return true, nil
+}
+
+func isToday(date time.Time) bool {
+	return date.Format("20060102") == time.Now().Format("20060102")
+}
+
+// printStageResults は工程ごとの実行結果を出力し、失敗した工程のエラーをまとめて返す
+func printStageResults(results []stageResult) error {
+	var errs error
+	for _, r := range results {
+		line := fmt.Sprintf("%s %-10s %s", r.date.Format("20060102"), r.name, r.status)
+		switch {
+		case r.err != nil:
+			line += fmt.Sprintf(" (%v)", r.err)
+			errs = multierror.Append(errs, errors.WithMessagef(r.err, "%s %s", r.date.Format("20060102"), r.name))
+		case r.reason != "":
+			line += fmt.Sprintf(" (%s)", r.reason)
+		}
+		fmt.Println(line)
+	}
+	return errs
+}
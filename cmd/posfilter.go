@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// defaultPOSPreset は品詞フィルタを指定しなかった場合に用いるプリセット
+const defaultPOSPreset = "person"
+
+// posPresets は品詞フィルタの名前付きプリセット
+// パターンは MeCab の素性と同じくカンマ区切りで、`*` は任意の値にマッチする
+var posPresets = map[string][]string{
+	"person":           {"名詞,固有名詞,人名,一般"},
+	"organization":     {"名詞,固有名詞,組織"},
+	"place":            {"名詞,固有名詞,地域"},
+	"all-proper-nouns": {"名詞,固有名詞"},
+}
+
+// posPattern は品詞パターンを表す
+// 省略された後ろの素性は任意の値にマッチする
+type posPattern []string
+
+func parsePOSPattern(s string) posPattern {
+	return posPattern(strings.Split(s, ","))
+}
+
+func (p posPattern) match(features []string) bool {
+	for i, want := range p {
+		if want == "*" {
+			continue
+		}
+		if i >= len(features) || features[i] != want {
+			return false
+		}
+	}
+	return true
+}
+
+// posFilter はいずれかのパターンにマッチする品詞を抽出対象とするフィルタを表す
+type posFilter []posPattern
+
+func (f posFilter) match(features []string) bool {
+	for _, p := range f {
+		if p.match(features) {
+			return true
+		}
+	}
+	return false
+}
+
+// newPOSFilter はプリセット名または品詞パターンのリストから品詞フィルタを生成する
+// path が指定された場合は、JSONファイルに定義されたプリセットを追加で読み込む
+func newPOSFilter(names []string, path string) (posFilter, error) {
+	presets := make(map[string][]string, len(posPresets))
+	for name, patterns := range posPresets {
+		presets[name] = patterns
+	}
+	if path != "" {
+		custom, err := readPOSPresets(path)
+		if err != nil {
+			return nil, err
+		}
+		for name, patterns := range custom {
+			presets[name] = patterns
+		}
+	}
+
+	if len(names) == 0 {
+		names = []string{defaultPOSPreset}
+	}
+	var f posFilter
+	for _, name := range names {
+		if patterns, ok := presets[name]; ok {
+			for _, p := range patterns {
+				f = append(f, parsePOSPattern(p))
+			}
+			continue
+		}
+		if !strings.Contains(name, ",") {
+			return nil, flagError{Message: "unknown pos preset: %s", Args: []interface{}{name}}
+		}
+		f = append(f, parsePOSPattern(name))
+	}
+	return f, nil
+}
+
+// readPOSPresets はプリセット名から品詞パターンのリストへのJSONファイルを読み込む
+// (例: {"event": ["名詞,固有名詞,一般", "名詞,サ変接続"]})
+func readPOSPresets(path string) (map[string][]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read pos preset file: %s", path)
+	}
+	var presets map[string][]string
+	if err := json.Unmarshal(b, &presets); err != nil {
+		return nil, errors.Wrapf(err, "could not unmarshal: %s", path)
+	}
+	return presets, nil
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html/template"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// siteTmplStr は静的サイトの各ページのテンプレート
+const siteTmplStr = `
+{{- define "header" -}}
+<!DOCTYPE html>
+<html lang="ja">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{ .Title }}</title>
+<style>
+body { font-family: sans-serif; line-height: 1.6; max-width: 960px; margin: 0 auto; padding: 1em; color: #222; }
+a { color: #0645ad; text-decoration: none; }
+a:hover { text-decoration: underline; }
+header.site { border-bottom: 1px solid #ddd; margin-bottom: 1em; }
+header.site a { margin-right: 1em; }
+h1 { font-size: 1.5em; }
+h2 { font-size: 1.25em; border-bottom: 1px solid #ddd; margin-top: 2em; }
+nav.pager { display: flex; justify-content: space-between; margin: 1em 0; }
+summary { cursor: pointer; }
+.count { color: #666; font-size: 0.9em; margin-left: 0.5em; }
+table { border-collapse: collapse; }
+th, td { border-bottom: 1px solid #eee; padding: 0.25em 0.75em; text-align: left; }
+</style>
+</head>
+<body>
+<header class="site"><a href="{{ .Root }}index.html">トップ</a><a href="{{ .Root }}keywords/index.html">キーワード一覧</a></header>
+<h1>{{ .Title }}</h1>
+{{- end }}
+
+{{- define "pager" -}}
+<nav class="pager">
+<span>{{ with .Prev }}<a href="{{ .URL }}">« {{ .Title }}</a>{{ end }}</span>
+<span>{{ with .Next }}<a href="{{ .URL }}">{{ .Title }} »</a>{{ end }}</span>
+</nav>
+{{- end }}
+
+{{- define "footer" -}}
+</body>
+</html>
+{{- end }}
+
+{{- define "index" -}}
+{{ template "header" . }}
+{{ with .Day -}}
+<h2>最新: <a href="days/{{ .Name }}.html">{{ .Content.FormatDate }}</a></h2>
+<ol>
+{{ range .Content.Items -}}
+<li><a href="{{ keywordURL .Word }}">{{ .Word }}</a><span class="count">{{ .Count }}{{ $.Day.Content.Unit }}</span></li>
+{{ end -}}
+</ol>
+{{ end -}}
+<h2>月別アーカイブ</h2>
+<ul>
+{{ range .Months -}}
+<li><a href="months/{{ .Name }}.html">{{ .Title }}</a><span class="count">{{ len .Days }}日</span></li>
+{{ end -}}
+</ul>
+{{ template "footer" . }}
+{{- end }}
+
+{{- define "day" -}}
+{{ template "header" . }}
+{{ template "pager" . }}
+{{ with .Day -}}
+<p><a href="../months/{{ .MonthName }}.html">{{ .MonthTitle }}のアーカイブ</a></p>
+<ol>
+{{ range .Content.Items -}}
+<li><details><summary><a href="../{{ keywordURL .Word }}">{{ .Word }}</a><span class="count">{{ .Count }}{{ $.Day.Content.Unit }}</span></summary>
+<ul>
+{{ range .Articles -}}
+<li><a href="{{ .URL }}">{{ .Title }}</a></li>
+{{ end -}}
+</ul>
+</details></li>
+{{ end -}}
+</ol>
+{{ end -}}
+{{ template "pager" . }}
+{{ template "footer" . }}
+{{- end }}
+
+{{- define "month" -}}
+{{ template "header" . }}
+{{ template "pager" . }}
+{{ with .Month -}}
+<table>
+<tr><th>日付</th><th>上位のキーワード</th></tr>
+{{ range .Days -}}
+<tr><td><a href="../days/{{ .Name }}.html">{{ .Content.FormatDate }}</a></td><td>
+{{- range $i, $item := .Content.Items }}{{ if lt $i 5 }}{{ if $i }}、{{ end }}<a href="../{{ keywordURL $item.Word }}">{{ $item.Word }}</a>{{ end }}{{ end -}}
+</td></tr>
+{{ end -}}
+</table>
+{{ end -}}
+{{ template "pager" . }}
+{{ template "footer" . }}
+{{- end }}
+
+{{- define "keyword" -}}
+{{ template "header" . }}
+{{ with .Keyword -}}
+<p>{{ len .Ranks }}日ランクイン</p>
+<table>
+<tr><th>日付</th><th>順位</th><th>数</th></tr>
+{{ range .Ranks -}}
+<tr><td><a href="../days/{{ .Day.Name }}.html">{{ .Day.Content.FormatDate }}</a></td><td>{{ .Rank }}位</td><td>{{ .Count }}{{ .Day.Content.Unit }}</td></tr>
+{{ end -}}
+</table>
+{{ end -}}
+{{ template "footer" . }}
+{{- end }}
+
+{{- define "keywords" -}}
+{{ template "header" . }}
+<ul>
+{{ range .Keywords -}}
+<li><a href="../{{ keywordURL .Word }}">{{ .Word }}</a><span class="count">{{ len .Ranks }}日</span></li>
+{{ end -}}
+</ul>
+{{ template "footer" . }}
+{{- end }}
+`
+
+// dayDirPattern は日次の集計結果のディレクトリ名 (YYYYMMDD)
+var dayDirPattern = regexp.MustCompile(`^\d{8}$`)
+
+// siteDay は日次のランキングのページを表す
+type siteDay struct {
+	// Name は YYYYMMDD 形式の日付
+	Name    string
+	Date    time.Time
+	Content Content
+}
+
+// MonthName は日付の月を YYYYMM 形式で返す
+func (d *siteDay) MonthName() string {
+	return d.Date.Format("200601")
+}
+
+// MonthTitle は日付の月を表示用に返す
+func (d *siteDay) MonthTitle() string {
+	return d.Date.Format("2006年1月")
+}
+
+// siteMonth は月別アーカイブのページを表す
+type siteMonth struct {
+	// Name は YYYYMM 形式の月
+	Name  string
+	Title string
+	Days  []*siteDay
+}
+
+// siteKeyword はキーワードがランクインした日の一覧のページを表す
+type siteKeyword struct {
+	Word  string
+	Ranks []siteRank
+}
+
+// siteRank はある日のキーワードの順位を表す
+type siteRank struct {
+	Day   *siteDay
+	Rank  int
+	Count int
+}
+
+// siteLink は前後のページへのリンクを表す
+type siteLink struct {
+	Title string
+	URL   string
+}
+
+// sitePage はページのテンプレートに渡すデータを表す
+type sitePage struct {
+	Title string
+	// Root はページからサイトのルートへの相対パス
+	Root       string
+	Prev, Next *siteLink
+	Day        *siteDay
+	Month      *siteMonth
+	Keyword    *siteKeyword
+	Months     []*siteMonth
+	Keywords   []*siteKeyword
+}
+
+// generateSite は src 直下の YYYYMMDD/<topicFile> を全て読み込んで、dest に静的サイトを生成する
+// トップページ、日ごとのページ、月別アーカイブ、キーワードごとのページを生成し、日と月のページには前後へのリンクを付ける
+func generateSite(src, dest, topicFile string) error {
+	days, err := readSiteDays(src, topicFile)
+	if err != nil {
+		return err
+	}
+	if len(days) == 0 {
+		return errors.Errorf("no %s found in %s", topicFile, src)
+	}
+	months := siteMonths(days)
+	keywords := siteKeywords(days)
+
+	t, err := template.New("site").Funcs(template.FuncMap{"keywordURL": keywordURL}).Parse(siteTmplStr)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse site template")
+	}
+	render := func(name, path string, page sitePage) error {
+		return writeReport(filepath.Join(dest, path), t.Lookup(name), page)
+	}
+
+	if err := render("index", "index.html", sitePage{
+		Title:  "話題になったキーワードランキング",
+		Day:    days[len(days)-1],
+		Months: months,
+	}); err != nil {
+		return err
+	}
+
+	for i, day := range days {
+		page := sitePage{
+			Title: day.Content.FormatDate + " に話題になったキーワードランキング",
+			Root:  "../",
+			Day:   day,
+		}
+		if i > 0 {
+			page.Prev = &siteLink{Title: days[i-1].Content.FormatDate, URL: days[i-1].Name + ".html"}
+		}
+		if i < len(days)-1 {
+			page.Next = &siteLink{Title: days[i+1].Content.FormatDate, URL: days[i+1].Name + ".html"}
+		}
+		if err := render("day", filepath.Join("days", day.Name+".html"), page); err != nil {
+			return err
+		}
+	}
+
+	// 月別アーカイブは新しい順に並んでいる
+	for i, month := range months {
+		page := sitePage{
+			Title: month.Title + "のアーカイブ",
+			Root:  "../",
+			Month: month,
+		}
+		if i < len(months)-1 {
+			page.Prev = &siteLink{Title: months[i+1].Title, URL: months[i+1].Name + ".html"}
+		}
+		if i > 0 {
+			page.Next = &siteLink{Title: months[i-1].Title, URL: months[i-1].Name + ".html"}
+		}
+		if err := render("month", filepath.Join("months", month.Name+".html"), page); err != nil {
+			return err
+		}
+	}
+
+	for _, k := range keywords {
+		page := sitePage{
+			Title:   k.Word + " がランクインした日",
+			Root:    "../",
+			Keyword: k,
+		}
+		if err := render("keyword", filepath.Join("keywords", keywordSlug(k.Word)+".html"), page); err != nil {
+			return err
+		}
+	}
+	return render("keywords", filepath.Join("keywords", "index.html"), sitePage{
+		Title:    "キーワード一覧",
+		Root:     "../",
+		Keywords: keywords,
+	})
+}
+
+// readSiteDays は src 直下の日付ディレクトリのランキングを日付順に読み込む
+// ランキングのファイルがない日は読み飛ばす
+func readSiteDays(src, topicFile string) ([]*siteDay, error) {
+	infos, err := ioutil.ReadDir(src)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read directory: %s", src)
+	}
+	var days []*siteDay
+	for _, info := range infos {
+		if !info.IsDir() || !dayDirPattern.MatchString(info.Name()) {
+			continue
+		}
+		date, err := time.ParseInLocation("20060102", info.Name(), time.Local)
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(src, info.Name(), topicFile)
+		ok, err := exists(path)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		c, err := readContent(path)
+		if err != nil {
+			// 読み込めないランキングがあってもサイトは生成するので warnnig log を出力する
+			fmt.Println("failed to read ranking.", zap.String("path", path), zap.Error(err))
+			continue
+		}
+		days = append(days, &siteDay{Name: info.Name(), Date: date, Content: c})
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Name < days[j].Name })
+	return days, nil
+}
+
+// siteMonths は日を月ごとにまとめて新しい月から順に返す
+func siteMonths(days []*siteDay) []*siteMonth {
+	var months []*siteMonth
+	for i := len(days) - 1; i >= 0; i-- {
+		day := days[i]
+		if len(months) == 0 || months[len(months)-1].Name != day.MonthName() {
+			months = append(months, &siteMonth{Name: day.MonthName(), Title: day.MonthTitle()})
+		}
+		m := months[len(months)-1]
+		// 月の中は日付順に並べる
+		m.Days = append([]*siteDay{day}, m.Days...)
+	}
+	return months
+}
+
+// siteKeywords はキーワードごとにランクインした日を集めて、ランクインした日数の多い順、キーワード順に返す
+func siteKeywords(days []*siteDay) []*siteKeyword {
+	m := make(map[string]*siteKeyword)
+	for _, day := range days {
+		for i, item := range day.Content.Items {
+			k, ok := m[item.Word]
+			if !ok {
+				k = &siteKeyword{Word: item.Word}
+				m[item.Word] = k
+			}
+			k.Ranks = append(k.Ranks, siteRank{Day: day, Rank: i + 1, Count: item.Count})
+		}
+	}
+	ret := make([]*siteKeyword, 0, len(m))
+	for _, k := range m {
+		ret = append(ret, k)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if len(ret[i].Ranks) != len(ret[j].Ranks) {
+			return len(ret[i].Ranks) > len(ret[j].Ranks)
+		}
+		return ret[i].Word < ret[j].Word
+	})
+	return ret
+}
+
+// keywordSlug はキーワードのページのファイル名 (拡張子を除く) を返す
+// パスの区切りなどファイル名に使えない文字は _ に置き換え、キーワード一覧のページと重ならないようにする
+// 置き換えた場合は別のキーワードと同じファイル名にならないよう、キーワードのハッシュを付ける
+func keywordSlug(word string) string {
+	slug := strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|', '#', '%':
+			return '_'
+		}
+		return r
+	}, word)
+	if slug == "index" {
+		slug = "index_"
+	}
+	if slug == word {
+		return slug
+	}
+	h := fnv.New32a()
+	h.Write([]byte(word))
+	return fmt.Sprintf("%s-%08x", slug, h.Sum32())
+}
+
+// keywordURL はサイトのルートからキーワードのページへの相対URLを返す
+func keywordURL(word string) string {
+	return "keywords/" + url.PathEscape(keywordSlug(word)) + ".html"
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// countUnits は `--count-by` フラグに指定できるキーワードの数え方
+var countUnits = []string{"article", "story"}
+
+// storyOptions はほぼ同じ見出しの記事をストーリーにまとめる設定を表す
+type storyOptions struct {
+	// enabled はストーリーをファイルに出力する場合に true
+	enabled bool
+	// countBy はキーワードの数え方 (article: 記事ごと, story: ストーリーごと)
+	countBy string
+	// similarity は同じストーリーとみなす見出しの文字 n-gram の Jaccard 係数の下限
+	similarity float64
+	// ngram は見出しを比較する文字 n-gram の n
+	ngram int
+	// storiesFile は出力するストーリーのファイル名
+	storiesFile string
+}
+
+func defaultStoryOptions() storyOptions {
+	return storyOptions{
+		countBy:     "article",
+		similarity:  0.5,
+		ngram:       2,
+		storiesFile: "stories.json",
+	}
+}
+
+// Story はほぼ同じ見出しで報じられた記事のまとまりを表す
+type Story struct {
+	ID int `json:"id"`
+	// Title は最も早い記事の見出し
+	Title    string    `json:"title"`
+	Articles []Article `json:"articles"`
+}
+
+// minHashSize は見出しの MinHash の署名に用いるハッシュ関数の数
+const minHashSize = 128
+
+// clusterStories は正規化した見出しの文字 n-gram の類似度が similarity 以上の記事を同じストーリーにまとめる
+// 全ての記事の組を比較すると記事数の2乗に比例して遅くなるので、MinHash の署名を LSH でバケットに分け、
+// 同じバケットに入った記事の組だけ Jaccard 係数を計算する
+// 類似した記事の組を順につないでまとめるため、直接は似ていない記事が同じストーリーになることがある
+// ストーリーは記事数の多い順、最も早い記事の日時順に並べて 1 から順に ID を振る
+func clusterStories(articles []NewsArticleJSON, ex *keywordExtractor, opts storyOptions) []Story {
+	grams := make([][]uint64, len(articles))
+	for i, article := range articles {
+		grams[i] = titleGrams(storyTitle(article.Title, ex.normalizer), opts.ngram)
+	}
+
+	parent := make([]int, len(articles))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	rows := lshRows(opts.similarity)
+	buckets := make(map[[2]uint64][]int)
+	for i := range articles {
+		if len(grams[i]) == 0 {
+			continue
+		}
+		sig := minHash(grams[i])
+		for band := 0; band*rows < minHashSize; band++ {
+			h := fnv.New64a()
+			for _, v := range sig[band*rows : minInt((band+1)*rows, minHashSize)] {
+				var b [8]byte
+				binary.LittleEndian.PutUint64(b[:], v)
+				h.Write(b[:])
+			}
+			key := [2]uint64{uint64(band), h.Sum64()}
+			buckets[key] = append(buckets[key], i)
+		}
+	}
+	for _, b := range buckets {
+		for x := 0; x < len(b); x++ {
+			for y := x + 1; y < len(b); y++ {
+				i, j := b[x], b[y]
+				if find(i) == find(j) {
+					continue
+				}
+				if jaccard(grams[i], grams[j]) >= opts.similarity {
+					parent[find(j)] = find(i)
+				}
+			}
+		}
+	}
+
+	byRoot := make(map[int][]Article)
+	for i, article := range articles {
+		root := find(i)
+		byRoot[root] = append(byRoot[root], article.article())
+	}
+	stories := make([]Story, 0, len(byRoot))
+	for _, a := range byRoot {
+		sortArticles(a)
+		stories = append(stories, Story{Title: a[0].Title, Articles: a})
+	}
+	sort.Slice(stories, func(i, j int) bool {
+		si, sj := stories[i], stories[j]
+		if len(si.Articles) != len(sj.Articles) {
+			return len(si.Articles) > len(sj.Articles)
+		}
+		if di, dj := parseArticleDate(si.Articles[0].Date), parseArticleDate(sj.Articles[0].Date); !di.Equal(dj) {
+			return di.Before(dj)
+		}
+		return si.Articles[0].URL < sj.Articles[0].URL
+	})
+	for i := range stories {
+		stories[i].ID = i + 1
+	}
+	return stories
+}
+
+// lshRows は LSH の1バンドあたりの行数を返す
+// 候補となる確率が 1/2 になる Jaccard 係数 (1/バンド数)^(1/行数) が similarity の8割以下になる最大の行数とし、
+// similarity 以上の記事の組をほぼ取りこぼさないようにする
+func lshRows(similarity float64) int {
+	rows := 1
+	for r := 2; r <= minHashSize; r++ {
+		bands := minHashSize / r
+		if math.Pow(1/float64(bands), 1/float64(r)) > similarity*0.8 {
+			break
+		}
+		rows = r
+	}
+	return rows
+}
+
+// minHash は n-gram のハッシュの集合の MinHash の署名を返す
+// i 番目のハッシュ関数は n-gram のハッシュを i から決まる値と混ぜ合わせたもので、実行ごとに同じ結果になる
+func minHash(grams []uint64) []uint64 {
+	sig := make([]uint64, minHashSize)
+	for i := range sig {
+		sig[i] = math.MaxUint64
+	}
+	for _, g := range grams {
+		for i := range sig {
+			if v := mix64(g ^ (uint64(i+1) * 0x9e3779b97f4a7c15)); v < sig[i] {
+				sig[i] = v
+			}
+		}
+	}
+	return sig
+}
+
+// mix64 は splitmix64 の最終段で64ビットの値を攪拌する
+func mix64(x uint64) uint64 {
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// storyIndex は記事のURLからストーリーのIDを引けるようにする
+func storyIndex(stories []Story) map[string]int {
+	m := make(map[string]int)
+	for _, s := range stories {
+		for _, a := range s.Articles {
+			m[a.URL] = s.ID
+		}
+	}
+	return m
+}
+
+// multiArticleStories は複数の記事からなるストーリーだけを返す
+func multiArticleStories(stories []Story) []Story {
+	var ret []Story
+	for _, s := range stories {
+		if len(s.Articles) > 1 {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+// storyTitle は見出しを正規化ルールで正規化して、NFKC正規化した上で空白と記号を取り除く
+// 集計から除く見出しの場合は空を返す
+func storyTitle(title string, normalizer *titleNormalizer) string {
+	title, ok := normalizer.normalize(title)
+	if !ok {
+		return ""
+	}
+	title = strings.ToLower(norm.NFKC.String(title))
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			return -1
+		}
+		return r
+	}, title)
+}
+
+// titleGrams は文字 n-gram のハッシュを重複なく昇順で返す。n 文字に満たない場合は全体を1つの n-gram とする
+func titleGrams(title string, n int) []uint64 {
+	runes := []rune(title)
+	if len(runes) == 0 {
+		return nil
+	}
+	if n < 1 {
+		n = 1
+	}
+	if len(runes) < n {
+		n = len(runes)
+	}
+	seen := make(map[uint64]bool)
+	var ret []uint64
+	for i := 0; i+n <= len(runes); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(string(runes[i : i+n])))
+		v := h.Sum64()
+		if seen[v] {
+			continue
+		}
+		seen[v] = true
+		ret = append(ret, v)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i] < ret[j] })
+	return ret
+}
+
+// jaccard は昇順に並んだ2つの集合の Jaccard 係数を返す
+func jaccard(a, b []uint64) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	var inter int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			inter++
+			i++
+			j++
+		case a[i] < b[j]:
+			i++
+		default:
+			j++
+		}
+	}
+	return float64(inter) / float64(len(a)+len(b)-inter)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// reportData はレポートのテンプレートに渡すデータを表す
+// Content のフィールドとメソッドをそのまま参照できる (例: {{ .FormatDate }}, {{ range .Items }}, {{ .Unit }})
+type reportData struct {
+	Content
+	// Tabs は全体 (Name が "全体") とカテゴリ別のランキング
+	Tabs []reportTab
+}
+
+// reportTab は全体またはカテゴリ別のランキングを表す
+type reportTab struct {
+	Name  string
+	Items []ContentItem
+}
+
+func newReportData(c Content) reportData {
+	data := reportData{
+		Content: c,
+		Tabs:    []reportTab{{Name: "全体", Items: c.Items}},
+	}
+	for _, category := range c.Categories {
+		data.Tabs = append(data.Tabs, reportTab{Name: category.Name, Items: category.Items})
+	}
+	return data
+}
+
+// reportFuncMap はレポートのテンプレートで使える関数
+//   - rank i: 0 から始まる添字を 1 から始まる順位にする
+//   - join list sep: 文字列のリストを sep でつなげる
+//   - truncate n s: s が n 文字を超える場合は n 文字に切り詰めて … を付ける
+//   - date layout s: RFC3339 または YYYYMMDD 形式の日時を Go のレイアウト (例: "2006年1月2日") で整形する
+//   - urlescape s: URL のクエリパラメータとしてエスケープする
+//   - pathescape s: URL のパスの1要素としてエスケープする
+var reportFuncMap = map[string]interface{}{
+	"rank":       func(i int) int { return i + 1 },
+	"join":       strings.Join,
+	"truncate":   truncate,
+	"date":       formatDate,
+	"urlescape":  url.QueryEscape,
+	"pathescape": url.PathEscape,
+}
+
+func truncate(n int, s string) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "…"
+}
+
+func formatDate(layout, s string) (string, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t, err = time.Parse("20060102", s)
+	}
+	if err != nil {
+		return "", errors.Errorf("invalid date: %s", s)
+	}
+	return t.Format(layout), nil
+}
+
+// reportTemplate は text/template と html/template のテンプレートを表す
+type reportTemplate interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// parseReportTemplate はレポートのテンプレートを読み込む
+// paths にはテンプレートファイルかディレクトリを指定し、ディレクトリの場合は直下のファイルを全て読み込む
+// name のテンプレート (空の場合は最初のファイル名のテンプレート) をレポートとして出力し、他のファイルは部品として参照できる
+// paths が空の場合は builtin を用いる。format が html の場合は html/template でエスケープする
+func parseReportTemplate(format, builtin string, paths []string, name string) (reportTemplate, error) {
+	files, err := templateFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) > 0 && name == "" {
+		name = filepath.Base(files[0])
+	}
+	if len(files) == 0 {
+		name = "report"
+	}
+
+	if format == "html" {
+		t := htmltemplate.New(name).Funcs(htmltemplate.FuncMap(reportFuncMap))
+		if len(files) == 0 {
+			_, err = t.Parse(builtin)
+		} else {
+			_, err = t.ParseFiles(files...)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse template")
+		}
+		if t.Lookup(name) == nil {
+			return nil, errors.Errorf("template not found: %s", name)
+		}
+		return t.Lookup(name), nil
+	}
+
+	t := texttemplate.New(name).Funcs(texttemplate.FuncMap(reportFuncMap))
+	if len(files) == 0 {
+		_, err = t.Parse(builtin)
+	} else {
+		_, err = t.ParseFiles(files...)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse template")
+	}
+	if t.Lookup(name) == nil {
+		return nil, errors.Errorf("template not found: %s", name)
+	}
+	return t.Lookup(name), nil
+}
+
+// templateFiles はテンプレートファイルのパスを返す。ディレクトリの場合は直下の隠しファイル以外のファイルを名前順に返す
+func templateFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to stat: %s", path)
+		}
+		if !stat.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		infos, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read directory: %s", path)
+		}
+		var names []string
+		for _, info := range infos {
+			if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+				continue
+			}
+			names = append(names, filepath.Join(path, info.Name()))
+		}
+		sort.Strings(names)
+		files = append(files, names...)
+	}
+	return files, nil
+}
+
+// writeReport はテンプレートにデータを渡してレポートを出力する
+// テンプレートの実行に失敗した場合に前回のレポートを途中まで上書きしないよう、全て描画してからファイルに書き込む
+func writeReport(path string, t reportTemplate, data interface{}) error {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return errors.Wrapf(err, "failed to render report: %s", path)
+	}
+
+	f, err := createOutFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := buf.WriteTo(f); err != nil {
+		return errors.Wrapf(err, "failed to write report: %s", path)
+	}
+	if err := f.Sync(); err != nil {
+		return errors.Wrap(err, "failed to sync file")
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// Score は TF-IDF によるキーワードのスコアと、その内訳を表す
+// 過去の1日分の記事を1文書として、毎日のように現れるキーワードほど IDF が小さくなる
+type Score struct {
+	// TF は集計期間にキーワードが現れた記事数
+	TF int `json:"tf"`
+	// DF は過去の日のうちキーワードが現れた日数
+	DF int `json:"df"`
+	// Documents は DF を集計した過去の日数
+	Documents int `json:"documents"`
+	// IDF は log((Documents+1)/(DF+1))+1
+	IDF   float64 `json:"idf"`
+	TFIDF float64 `json:"tfidf"`
+}
+
+// documentFrequency は過去の日ごとの記事から集計したキーワードの文書頻度を表す
+type documentFrequency struct {
+	// days は文書頻度を集計した日 (YYYYMMDD)
+	days []string
+	df   map[string]int
+}
+
+// newDocumentFrequency は start より前の days 日間の記事から文書頻度を集計する
+func newDocumentFrequency(counter *dayCounter, start time.Time, days int) (*documentFrequency, error) {
+	counts, found, err := countBaseline(counter, start, days)
+	if err != nil {
+		return nil, err
+	}
+	df := make(map[string]int)
+	for _, c := range counts {
+		for word := range c {
+			df[word]++
+		}
+	}
+	return &documentFrequency{days: found, df: df}, nil
+}
+
+// score はキーワードごとに TF-IDF を算出して m に設定する
+func (d *documentFrequency) score(m map[string]ContentItem) {
+	n := len(d.days)
+	for word, item := range m {
+		df := d.df[word]
+		idf := math.Log(float64(n+1)/float64(df+1)) + 1
+		item.Score = &Score{
+			TF:        item.Count,
+			DF:        df,
+			Documents: n,
+			IDF:       idf,
+			TFIDF:     float64(item.Count) * idf,
+		}
+		m[word] = item
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+const ipadic = "/usr/local/lib/mecab/dic/mecab-ipadic-neologd"
+
+// ipadicBaseFormIndex は IPA 辞書の素性における原形の位置
+const ipadicBaseFormIndex = 6
+
+// Token は形態素解析によって分割された形態素を表す
+type Token struct {
+	// Surface は表層形
+	Surface string
+	// Features は品詞、活用、原形などの素性
+	Features []string
+	// BaseForm は原形。辞書に原形がない場合は表層形
+	BaseForm string
+}
+
+// Tokenizer は文字列を形態素に分割するインタフェースを表す
+type Tokenizer interface {
+	Tokenize(s string) ([]Token, error)
+	Close() error
+}
+
+// tokenizerNames は `--tokenizer` フラグに指定できる形態素解析器の名前
+var tokenizerNames = []string{"mecab", "kagome"}
+
+// newTokenizer は名前に対応する形態素解析器を生成する
+func newTokenizer(name string) (Tokenizer, error) {
+	switch name {
+	case "mecab":
+		return newMeCabTokenizer(ipadic)
+	case "kagome":
+		return newKagomeTokenizer()
+	default:
+		return nil, errors.Errorf("invalid tokenizer: %s", name)
+	}
+}
+
+// baseFormAt は素性の index 番目にある原形を返す。原形がない場合は表層形を返す
+func baseFormAt(surface string, features []string, index int) string {
+	if index < len(features) && features[index] != "" && features[index] != "*" {
+		return features[index]
+	}
+	return surface
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/ikawaha/kagome-dict/ipa"
+	"github.com/ikawaha/kagome/v2/tokenizer"
+	"github.com/pkg/errors"
+)
+
+// kagomeTokenizer は IPA 辞書を埋め込んだ kagome を用いた形態素解析器
+// libmecab や NEologd をインストールしていない環境でも動作する
+type kagomeTokenizer struct {
+	tokenizer *tokenizer.Tokenizer
+}
+
+func newKagomeTokenizer() (Tokenizer, error) {
+	t, err := tokenizer.New(ipa.Dict(), tokenizer.OmitBosEos())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize kagome")
+	}
+	return &kagomeTokenizer{tokenizer: t}, nil
+}
+
+func (t *kagomeTokenizer) Tokenize(s string) ([]Token, error) {
+	var tokens []Token
+	for _, token := range t.tokenizer.Tokenize(s) {
+		features := token.Features()
+		tokens = append(tokens, Token{
+			Surface:  token.Surface,
+			Features: features,
+			BaseForm: baseFormAt(token.Surface, features, ipadicBaseFormIndex),
+		})
+	}
+	return tokens, nil
+}
+
+func (t *kagomeTokenizer) Close() error {
+	return nil
+}
@@ -0,0 +1,51 @@
+//go:build !nomecab
+// +build !nomecab
+
+package main
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+
+	mecab "github.com/shogo82148/go-mecab"
+)
+
+// meCabTokenizer は go-mecab を用いた形態素解析器
+type meCabTokenizer struct {
+	mecab mecab.MeCab
+}
+
+func newMeCabTokenizer(dicdir string) (Tokenizer, error) {
+	m, err := mecab.New(map[string]string{"dicdir": dicdir})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to initialize mecab: %s", dicdir)
+	}
+	return &meCabTokenizer{mecab: m}, nil
+}
+
+func (t *meCabTokenizer) Tokenize(s string) ([]Token, error) {
+	node, err := t.mecab.ParseToNode(s)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse: %s", s)
+	}
+
+	var tokens []Token
+	for ; !node.IsZero(); node = node.Next() {
+		if node.Stat() == mecab.BOSNode || node.Stat() == mecab.EOSNode {
+			continue
+		}
+		features := strings.Split(node.Feature(), ",")
+		tokens = append(tokens, Token{
+			Surface:  node.Surface(),
+			Features: features,
+			BaseForm: baseFormAt(node.Surface(), features, ipadicBaseFormIndex),
+		})
+	}
+	return tokens, nil
+}
+
+func (t *meCabTokenizer) Close() error {
+	t.mecab.Destroy()
+	return nil
+}
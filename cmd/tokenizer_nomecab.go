@@ -0,0 +1,13 @@
+//go:build nomecab
+// +build nomecab
+
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+// nomecab タグを指定してビルドした場合は libmecab なしでビルドできるが、mecab は利用できない
+func newMeCabTokenizer(dicdir string) (Tokenizer, error) {
+	return nil, errors.New("mecab tokenizer is not available: built with nomecab tag")
+}
@@ -4,21 +4,16 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/PuerkitoBio/goquery"
 	"github.com/mmcdole/gofeed"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
-// newsArticleJSON transformしたニュース記事データ
-type newsArticleJSON struct {
-	Date  string `json:"date"`
-	URL   string `json:"url"`
-	Name  string `json:"name"`
-	Title string `json:"title"`
-}
-
 // transformJSON fetchしたRSSファイルからターゲット日に更新された記事を抽出する
 func transformJSON(src, dest string, date time.Time) error {
 	feeds, err := readYahooRSSFeed(filepath.Join(src, "rss.jsonl"))
@@ -36,75 +31,139 @@ func transformJSON(src, dest string, date time.Time) error {
 }
 
 // RSS設定JSONとfetchしたRSSファイルからターゲット日付のニュース記事を抽出して保存する
-func toArticleMap(feeds []YahooRSSFeed, src, dateStr string, date time.Time) (map[string]newsArticleJSON, error) {
-	m := make(map[string]newsArticleJSON)
+// 1日に複数回fetchした場合は、全てのスナップショットの記事をまとめる
+func toArticleMap(feeds []YahooRSSFeed, src, dateStr string, date time.Time) (map[string]NewsArticleJSON, error) {
+	m := make(map[string]NewsArticleJSON)
 	fileDir := filepath.Join(src, dateStr)
 	for _, feed := range feeds {
-		filePath := filepath.Join(fileDir, feed.ID)
-		stat, err := os.Stat(filePath)
-		if err != nil || stat.IsDir() {
-			// RSSリストが更新されてfetchファイルが存在しないケース
-			continue
-		}
-		rss, err := os.Open(filePath)
+		snapshots, err := feedSnapshots(fileDir, feed)
 		if err != nil {
-			// RSSファイルの読み込み失敗しても処理は止めずに warnnig log を出力する
-			fmt.Println("failed to open RSS file.", zap.String("path", filePath), zap.Error(err))
+			return nil, err
+		}
+		// RSSリストが更新されてfetchファイルが存在しない場合は snapshots が空になる
+		for _, filePath := range snapshots {
+			seen, err := snapshotTime(filePath, dateStr)
+			if err != nil {
+				return nil, err
+			}
+			if err := appendSnapshotArticles(m, feed, filePath, seen, dateStr, date); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return m, nil
+}
+
+// snapshotTime はスナップショットのファイル名から取得時刻を返す
+// ファイル名が取得時刻でない場合はファイルの更新日時を返す
+func snapshotTime(path, dateStr string) (time.Time, error) {
+	name := strings.TrimSuffix(filepath.Base(path), ".xml")
+	if t, err := time.ParseInLocation("20060102"+snapshotLayout, dateStr+name, time.Local); err == nil {
+		return t, nil
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "failed to stat: %s", path)
+	}
+	return stat.ModTime(), nil
+}
+
+// appendSnapshotArticles はRSSのスナップショットからターゲット日付の記事を m に追加する
+// 記事を掲載していた全てのRSSと、スナップショットで最初と最後に見つけた時刻を記録する
+// 最初に見つけたRSSのIDと名前を記事のカテゴリとする
+func appendSnapshotArticles(m map[string]NewsArticleJSON, rssFeed YahooRSSFeed, filePath string, seen time.Time, dateStr string, date time.Time) error {
+	rss, err := os.Open(filePath)
+	if err != nil {
+		// RSSファイルの読み込み失敗しても処理は止めずに warnnig log を出力する
+		fmt.Println("failed to open RSS file.", zap.String("path", filePath), zap.Error(err))
+		return nil
+	}
+
+	gfp := gofeed.NewParser()
+	feed, parseErr := gfp.Parse(rss)
+	closeErr := rss.Close()
+	if closeErr != nil {
+		return errors.Wrapf(closeErr, "failed to close a rss reader: %s", filePath)
+	}
+	if parseErr != nil {
+		// RSSの解析に失敗しても処理は止めずに warnnig log を出力する
+		fmt.Println("failed to parse RSS.", zap.String("path", filePath), zap.Error(parseErr))
+		return nil
+	}
+	seenStr := seen.Format(time.RFC3339)
+	for _, item := range feed.Items {
+		if json, ok := m[item.Link]; ok {
+			json.addFeed(rssFeed)
+			if seenStr < json.FirstSeen {
+				json.FirstSeen = seenStr
+			}
+			if seenStr > json.LastSeen {
+				json.LastSeen = seenStr
+			}
+			m[item.Link] = json
 			continue
 		}
 
-		gfp := gofeed.NewParser()
-		feed, parseErr := gfp.Parse(rss)
-		closeErr := rss.Close()
-		if closeErr != nil {
-			return nil, errors.Wrapf(closeErr, "failed to close a rss reader: %s", filePath)
+		var articleDate time.Time
+		if item.PublishedParsed != nil {
+			articleDate = item.PublishedParsed.In(time.Local)
+		} else if item.UpdatedParsed != nil {
+			articleDate = item.UpdatedParsed.In(time.Local)
+		} else {
+			articleDate = date
 		}
-		if parseErr != nil {
-			// RSSの解析に失敗しても処理は止めずに warnnig log を出力する
-			fmt.Println("failed to parse RSS.", zap.String("path", filePath), zap.Error(parseErr))
+		if dateStr != articleDate.Format("20060102") {
 			continue
 		}
-		for _, item := range feed.Items {
-			if _, ok := m[item.Link]; ok {
-				continue
-			}
 
-			var articleDate time.Time
-			if item.PublishedParsed != nil {
-				articleDate = item.PublishedParsed.In(time.Local)
-			} else if item.UpdatedParsed != nil {
-				articleDate = item.UpdatedParsed.In(time.Local)
-			} else {
-				articleDate = date
-			}
-			if dateStr != articleDate.Format("20060102") {
-				continue
-			}
-
-			json := newsArticleJSON{
-				Date:  articleDate.Format(time.RFC3339),
-				URL:   item.Link,
-				Name:  feed.Title,
-				Title: item.Title,
-			}
-			m[item.Link] = json
+		json := NewsArticleJSON{
+			Date:       articleDate.Format(time.RFC3339),
+			URL:        item.Link,
+			Name:       feed.Title,
+			Title:      item.Title,
+			CategoryID: rssFeed.ID,
+			Category:   rssFeed.Name,
+			FirstSeen:  seenStr,
+			LastSeen:   seenStr,
+			// HTMLタグを取り除いた概要を保存する
+			Description: plainText(item.Description),
+			GUID:        item.GUID,
+			Categories:  item.Categories,
+			Image:       itemImage(item),
+		}
+		if item.Author != nil {
+			json.Author = item.Author.Name
 		}
+		json.addFeed(rssFeed)
+		m[item.Link] = json
 	}
-	return m, nil
+	return nil
 }
 
-// ニュース記事データをファイルに保存します
-func writeArticleJSOL(out, date, fileName string, m map[string]newsArticleJSON) error {
+// ニュース記事データを日時順、URL順にファイルに保存します
+func writeArticleJSOL(out, date, fileName string, m map[string]NewsArticleJSON) error {
 	if len(m) == 0 {
 		return nil
 	}
+	articles := make([]NewsArticleJSON, 0, len(m))
+	for _, json := range m {
+		articles = append(articles, json)
+	}
+	sort.Slice(articles, func(i, j int) bool {
+		di, dj := parseArticleDate(articles[i].Date), parseArticleDate(articles[j].Date)
+		if !di.Equal(dj) {
+			return di.Before(dj)
+		}
+		return articles[i].URL < articles[j].URL
+	})
+
 	f, err := createOutFile(filepath.Join(out, date, fileName))
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	for _, json := range m {
+	for _, json := range articles {
 		err = appendOutFile(f, json)
 		if err != nil {
 			return err
@@ -115,3 +174,40 @@ func writeArticleJSOL(out, date, fileName string, m map[string]newsArticleJSON)
 	}
 	return nil
 }
+
+// plainText はRSSの概要からHTMLタグを取り除いて、連続する空白を1つにまとめる
+func plainText(s string) string {
+	if s == "" {
+		return ""
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(s))
+	if err != nil {
+		return strings.Join(strings.Fields(s), " ")
+	}
+	return strings.Join(strings.Fields(doc.Text()), " ")
+}
+
+// itemImage は記事のサムネイル画像のURLを返す
+// RSSの image、画像の enclosure、media:thumbnail、画像の media:content の順に探す
+func itemImage(item *gofeed.Item) string {
+	if item.Image != nil && item.Image.URL != "" {
+		return item.Image.URL
+	}
+	for _, e := range item.Enclosures {
+		if strings.HasPrefix(e.Type, "image/") && e.URL != "" {
+			return e.URL
+		}
+	}
+	media := item.Extensions["media"]
+	for _, t := range media["thumbnail"] {
+		if url := t.Attrs["url"]; url != "" {
+			return url
+		}
+	}
+	for _, c := range media["content"] {
+		if url := c.Attrs["url"]; url != "" && (c.Attrs["medium"] == "image" || strings.HasPrefix(c.Attrs["type"], "image/")) {
+			return url
+		}
+	}
+	return ""
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"math"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// trendMetrics は急上昇キーワードのスコアの算出方法
+var trendMetrics = []string{"zscore", "burst"}
+
+// trendOptions は急上昇キーワード検出の設定を表す
+type trendOptions struct {
+	enabled bool
+	// baselineDays は比較対象とする集計期間より前の日数
+	baselineDays int
+	// metric はスコアの算出方法 (zscore, burst)
+	metric string
+	// threshold はスコアがこの値以上のキーワードを急上昇キーワードとする
+	threshold float64
+	// trendingFile は出力する急上昇キーワードのファイル名
+	trendingFile string
+}
+
+func defaultTrendOptions() trendOptions {
+	return trendOptions{
+		baselineDays: 7,
+		metric:       "zscore",
+		threshold:    2,
+		trendingFile: "trending.json",
+	}
+}
+
+// Trend はベースラインと比べたキーワードの出現数の変化を表す
+type Trend struct {
+	Metric string  `json:"metric"`
+	Score  float64 `json:"score"`
+	// Rate は集計期間の1日あたりの記事数
+	Rate float64 `json:"rate"`
+	// BaselineMean はベースラインの1日あたりの記事数の平均
+	BaselineMean float64 `json:"baseline_mean"`
+	// BaselineStdDev はベースラインの1日あたりの記事数の標準偏差
+	BaselineStdDev float64 `json:"baseline_stddev"`
+}
+
+// dayCounter は過去の日ごとのキーワードの記事数を集計する
+// 急上昇キーワードのベースラインと TF-IDF の文書頻度で同じ日を参照するため、集計した結果を日ごとに保持する
+type dayCounter struct {
+	src string
+	ex  *keywordExtractor
+	// counts は YYYYMMDD ごとの集計結果。記事ファイルがない日は nil
+	counts map[string]map[string]int
+}
+
+func newDayCounter(src string, ex *keywordExtractor) *dayCounter {
+	return &dayCounter{src: src, ex: ex, counts: make(map[string]map[string]int)}
+}
+
+// count は dateStr の日のキーワードごとの記事数を返す。記事ファイルがない日は false を返す
+// 過去の日の記事ファイルがないのは想定内なので、ログは出力せずに読み飛ばす
+func (c *dayCounter) count(dateStr string) (map[string]int, bool, error) {
+	if m, ok := c.counts[dateStr]; ok {
+		return m, m != nil, nil
+	}
+	found := false
+	for _, fileName := range newsArticleNames {
+		ok, err := exists(filepath.Join(c.src, dateStr, fileName))
+		if err != nil {
+			return nil, false, err
+		}
+		found = found || ok
+	}
+	if !found {
+		c.counts[dateStr] = nil
+		return nil, false, nil
+	}
+
+	articles, ok := readDayArticles(c.src, dateStr, c.ex.text != "title")
+	if !ok {
+		c.counts[dateStr] = nil
+		return nil, false, nil
+	}
+	m, err := countKeywords(articles, c.ex)
+	if err != nil {
+		return nil, false, errors.WithMessagef(err, "failed to count keywords: %s", dateStr)
+	}
+	counts := make(map[string]int, len(m))
+	for word, item := range m {
+		counts[word] = item.Count
+	}
+	c.counts[dateStr] = counts
+	return counts, true, nil
+}
+
+// countBaseline は start より前の days 日間について、日ごとのキーワードの記事数を集計する
+// 記事ファイルを読み込めた日を YYYYMMDD 形式で返す
+func countBaseline(counter *dayCounter, start time.Time, days int) ([]map[string]int, []string, error) {
+	var counts []map[string]int
+	var found []string
+	for i := days; i >= 1; i-- {
+		dateStr := start.AddDate(0, 0, -i).Format("20060102")
+		c, ok, err := counter.count(dateStr)
+		if err != nil {
+			return nil, nil, errors.WithMessage(err, "failed to count baseline")
+		}
+		if !ok {
+			continue
+		}
+		counts = append(counts, c)
+		found = append(found, dateStr)
+	}
+	return counts, found, nil
+}
+
+// toTrending はベースラインと比べて記事数が急増したキーワードをスコアの高い順に返す
+// numDays は counts を集計した日数で、1日あたりの記事数に換算して比較する
+func toTrending(counts map[string]ContentItem, numDays int, baseline []map[string]int, analysis analysisOptions) []ContentItem {
+	if numDays == 0 {
+		return nil
+	}
+	opts := analysis.trend
+	var ret []ContentItem
+	for word, item := range counts {
+		if item.Count < analysis.minCount {
+			continue
+		}
+		rate := float64(item.Count) / float64(numDays)
+		mean, stddev := meanStdDev(word, baseline)
+
+		var score float64
+		switch opts.metric {
+		case "burst":
+			// 加算スムージングしたベースラインに対する倍率
+			score = (rate + 1) / (mean + 1)
+		default:
+			// ベースラインの揺らぎが小さいキーワードが過大評価されないよう標準偏差の下限を1とする
+			score = (rate - mean) / math.Max(stddev, 1)
+		}
+		if score < opts.threshold {
+			continue
+		}
+
+		item.Trend = &Trend{
+			Metric:         opts.metric,
+			Score:          score,
+			Rate:           rate,
+			BaselineMean:   mean,
+			BaselineStdDev: stddev,
+		}
+		ret = append(ret, item)
+	}
+	sortContentItems(ret, func(c ContentItem) float64 { return c.Trend.Score })
+	return limitItems(ret, analysis.top)
+}
+
+// meanStdDev はベースラインにおけるキーワードの1日あたりの記事数の平均と標準偏差を返す
+func meanStdDev(word string, baseline []map[string]int) (float64, float64) {
+	if len(baseline) == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, c := range baseline {
+		sum += float64(c[word])
+	}
+	mean := sum / float64(len(baseline))
+	var sq float64
+	for _, c := range baseline {
+		d := float64(c[word]) - mean
+		sq += d * d
+	}
+	return mean, math.Sqrt(sq / float64(len(baseline)))
+}
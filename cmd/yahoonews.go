@@ -1,9 +1,7 @@
 package main
 
 import (
-	"bytes"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"path/filepath"
 	"strings"
@@ -11,8 +9,6 @@ import (
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/pkg/errors"
-	"github.com/saintfish/chardet"
-	"golang.org/x/net/html/charset"
 )
 
 const rssListURL = "https://news.yahoo.co.jp/rss"
@@ -34,7 +30,7 @@ func fetchYahooNewsRSSList(dest string, maxRetry uint) (err error) {
 			defer res.Body.Close()
 
 			if res.StatusCode != http.StatusOK {
-				return nil, errors.Errorf("status code expected 200 but was %d : url=%s", res.StatusCode)
+				return nil, errors.Errorf("status code expected 200 but was %d : url=%s", res.StatusCode, rssListURL)
 			}
 
 			feeds, err := getYahooRSSFeeds(res.Body)
@@ -57,22 +53,9 @@ func fetchYahooNewsRSSList(dest string, maxRetry uint) (err error) {
 }
 
 func getYahooRSSFeeds(r io.Reader) ([]link, error) {
-	buf, _ := ioutil.ReadAll(r)
-
-	// 文字コード判定
-	det := chardet.NewTextDetector()
-	detRslt, _ := det.DetectBest(buf)
-	// 文字コード変換
-	bReader := bytes.NewReader(buf)
-	reader, _ := charset.NewReaderLabel(detRslt.Charset, bReader)
-
-	doc, err := goquery.NewDocumentFromReader(reader)
+	doc, err := newHTMLDocument(r)
 	if err != nil {
-		b, err := ioutil.ReadAll(r)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to read response body")
-		}
-		return nil, errors.Wrapf(err, "failed parse response body : %s", string(b))
+		return nil, errors.Wrap(err, "failed parse response body")
 	}
 
 	var links []link